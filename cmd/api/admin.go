@@ -0,0 +1,94 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/data/validator"
+	"net/http"
+)
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", app.config.pagination.defaultPageSize, v)
+	input.Filters.MaxPageSize = app.config.pagination.maxPageSize
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.Order = app.readString(qs, "order", "asc")
+	input.Filters.SortSafeList = []string{"id", "name", "email", "created_at", "role"}
+	input.Filters.OrderSafeList = []string{"asc", "desc"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(r.Context(), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidatePageInRange(v, input.Filters, metadata); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", app.config.pagination.defaultPageSize, v)
+	input.Filters.MaxPageSize = app.config.pagination.maxPageSize
+	input.Filters.Sort = app.readString(qs, "sort", "at")
+	input.Filters.Order = app.readString(qs, "order", "desc")
+	input.Filters.SortSafeList = []string{"id", "at", "action", "user_id"}
+	input.Filters.OrderSafeList = []string{"asc", "desc"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Audit.GetAll(r.Context(), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidatePageInRange(v, input.Filters, metadata); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"audit_log": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// audit records an action in the audit log. Failing to do so is logged but
+// doesn't fail the request, as the action itself already happened.
+func (app *application) audit(r *http.Request, userId *int64, action string, resource string, resourceId *int64) {
+	err := app.models.Audit.Record(r.Context(), userId, action, resource, resourceId)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestListUsersRequiresAdmin(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	admin := insertTestUser(t, app, "admin@example.com")
+	user := insertTestUser(t, app, "alice@example.com")
+
+	_, err := app.db.Exec(context.Background(), "UPDATE users SET role = $1 WHERE id = $2", data.RoleAdmin, admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response struct {
+		Users    []data.User   `json:"users"`
+		Metadata data.Metadata `json:"metadata"`
+	}
+
+	status := do(t, app, http.MethodGet, "/v1/admin/users", authenticate(t, app, admin), nil, &response)
+	if status != http.StatusOK {
+		t.Fatalf("admin: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if len(response.Users) != 2 || response.Metadata.TotalRecords != 2 {
+		t.Errorf("admin: got %d users of %d; want 2 of 2", len(response.Users), response.Metadata.TotalRecords)
+	}
+
+	status = do(t, app, http.MethodGet, "/v1/admin/users", authenticate(t, app, user), nil, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("regular user: got status %d; want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	admin := insertTestUser(t, app, "admin@example.com")
+	user := insertTestUser(t, app, "alice@example.com")
+
+	_, err := app.db.Exec(context.Background(), "UPDATE users SET role = $1 WHERE id = $2", data.RoleAdmin, admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := authenticate(t, app, user)
+
+	_, id := createTodo(t, app, token, "Buy milk")
+
+	if status := do(t, app, http.MethodDelete, fmt.Sprintf("/v1/todos/%d", id), token, nil, nil); status != http.StatusOK {
+		t.Fatalf("deleting the todo: got status %d; want %d", status, http.StatusOK)
+	}
+
+	var response struct {
+		AuditLog []data.AuditEntry `json:"audit_log"`
+	}
+
+	status := do(t, app, http.MethodGet, "/v1/admin/audit?sort=id&order=asc", authenticate(t, app, admin), nil, &response)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	var actions []string
+
+	for _, entry := range response.AuditLog {
+		if entry.Resource != "todo" || entry.ResourceID == nil || *entry.ResourceID != id {
+			continue
+		}
+
+		if entry.UserID == nil || *entry.UserID != user.Id {
+			t.Errorf("%s: got user %v; want %d", entry.Action, entry.UserID, user.Id)
+		}
+
+		actions = append(actions, entry.Action)
+	}
+
+	if want := []string{data.AuditTodoCreate, data.AuditTodoDelete}; !slices.Equal(actions, want) {
+		t.Errorf("got actions %v for the todo; want %v", actions, want)
+	}
+
+	status = do(t, app, http.MethodGet, "/v1/admin/audit", token, nil, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("regular user: got status %d; want %d", status, http.StatusForbidden)
+	}
+}
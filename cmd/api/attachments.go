@@ -0,0 +1,136 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/data/validator"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	todoId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	var input struct {
+		URL      string `json:"url"`
+		Filename string `json:"filename"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	attachment := &data.Attachment{
+		URL:      input.URL,
+		Filename: input.Filename,
+	}
+
+	v := validator.New()
+
+	if data.ValidateAttachment(v, attachment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Without an explicit filename, fall back to the last element of the URL
+	// path, or the host for URLs without one.
+	if attachment.Filename == "" {
+		u, _ := url.Parse(attachment.URL)
+
+		attachment.Filename = path.Base(u.Path)
+		if attachment.Filename == "." || attachment.Filename == "/" {
+			attachment.Filename = u.Host
+		}
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Attachments.Insert(r.Context(), todoId, user.Id, attachment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "todo")
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"attachment": attachment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	todoId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Shared todos can be read by the user they're shared with, so go through
+	// Todos.Get for the access check rather than the owner-only attachment
+	// queries.
+	todo, err := app.models.Todos.Get(r.Context(), todoId, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "todo")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"attachments": todo.Attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	todoId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponseFor(w, r, "attachment")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Attachments.Delete(r.Context(), id, todoId, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "attachment")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "attachment deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	_, todoID := createTodo(t, app, alice, "Read the report")
+	path := fmt.Sprintf("/v1/todos/%d/attachments", todoID)
+
+	var created struct {
+		Attachment data.Attachment `json:"attachment"`
+	}
+
+	status := do(t, app, http.MethodPost, path, alice, map[string]string{"url": "https://example.com/files/report.pdf"}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("attaching: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if created.Attachment.Filename != "report.pdf" {
+		t.Errorf("got filename %q; want %q", created.Attachment.Filename, "report.pdf")
+	}
+
+	status = do(t, app, http.MethodPost, path, alice, map[string]string{"url": "not a url"}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("malformed URL: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	var list struct {
+		Attachments []data.Attachment `json:"attachments"`
+	}
+
+	if status := do(t, app, http.MethodGet, path, alice, nil, &list); status != http.StatusOK {
+		t.Fatalf("listing: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if len(list.Attachments) != 1 || list.Attachments[0].ID != created.Attachment.ID {
+		t.Errorf("listing: got %v; want the one attachment", list.Attachments)
+	}
+
+	// Another user can't see, add or remove the todo's attachments.
+	if status := do(t, app, http.MethodGet, path, bob, nil, nil); status != http.StatusNotFound {
+		t.Errorf("other user listing: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	status = do(t, app, http.MethodPost, path, bob, map[string]string{"url": "https://example.com"}, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("other user attaching: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	attachmentPath := fmt.Sprintf("%s/%d", path, created.Attachment.ID)
+
+	if status := do(t, app, http.MethodDelete, attachmentPath, bob, nil, nil); status != http.StatusNotFound {
+		t.Errorf("other user removing: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	if status := do(t, app, http.MethodDelete, attachmentPath, alice, nil, nil); status != http.StatusOK {
+		t.Errorf("removing: got status %d; want %d", status, http.StatusOK)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/data/validator"
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const icalTimeFormat = "20060102T150405Z"
+
+// createCalendarTokenHandler issues the long-lived token calendar apps use to
+// subscribe to the user's todos. Calendar apps can't send an Authorization
+// header, so the token goes in the feed URL; issuing a new one revokes the
+// previous URL.
+func (app *application) createCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var token *data.Token
+
+	err := app.models.WithTx(r.Context(), func(models data.Models) error {
+		_, err := models.Tokens.DeleteAllForUser(r.Context(), data.ScopeCalendar, user.Id)
+		if err != nil {
+			return err
+		}
+
+		token, err = models.Tokens.New(r.Context(), user.Id, 365*24*time.Hour, data.ScopeCalendar)
+		return err
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	feedURL := app.absoluteURL(r, "/v1/todos/calendar.ics") + "?" + url.Values{"token": {token.Plaintext}}.Encode()
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"calendar_token": token, "calendar_url": feedURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// calendarHandler serves the user's todos with a due date as an iCalendar
+// feed, authenticated with the calendar token in the token query parameter.
+func (app *application) calendarHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, token); !v.Valid() {
+		app.invalidAuthenticationHeaderResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Tokens.GetForToken(r.Context(), data.ScopeCalendar, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationHeaderResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	filters := data.Filters{
+		Sort:          "due_date",
+		Order:         "asc",
+		SortSafeList:  []string{"due_date"},
+		OrderSafeList: []string{"asc"},
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="todos.ics"`)
+
+	bw := bufio.NewWriter(w)
+	started := false
+	now := time.Now().UTC().Format(icalTimeFormat)
+
+	// Nothing is written until the first todo arrives, so a failing query can
+	// still be reported as a regular JSON error.
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+
+		writeICalLine(bw, "BEGIN:VCALENDAR")
+		writeICalLine(bw, "VERSION:2.0")
+		writeICalLine(bw, "PRODID:-//GoTodo//GoTodo "+version+"//EN")
+		writeICalLine(bw, "CALSCALE:GREGORIAN")
+		writeICalLine(bw, "X-WR-CALNAME:GoTodo")
+	}
+
+	err = app.models.Todos.Export(r.Context(), user.Id, "", nil, nil, filters, func(todo *data.Todo) error {
+		if todo.DueDate == nil {
+			return nil
+		}
+
+		start()
+
+		writeICalLine(bw, "BEGIN:VTODO")
+		writeICalLine(bw, fmt.Sprintf("UID:todo-%d@gotodo", todo.ID))
+		writeICalLine(bw, "DTSTAMP:"+now)
+		writeICalLine(bw, "CREATED:"+todo.CreatedAt.UTC().Format(icalTimeFormat))
+		writeICalLine(bw, "DUE:"+todo.DueDate.UTC().Format(icalTimeFormat))
+		writeICalLine(bw, "SUMMARY:"+escapeICalText(todo.Title))
+
+		if todo.Description != "" {
+			writeICalLine(bw, "DESCRIPTION:"+escapeICalText(todo.Description))
+		}
+
+		if todo.IsCompleted {
+			writeICalLine(bw, "STATUS:COMPLETED")
+		} else {
+			writeICalLine(bw, "STATUS:NEEDS-ACTION")
+			writeICalLine(bw, "BEGIN:VALARM")
+			writeICalLine(bw, "ACTION:DISPLAY")
+			writeICalLine(bw, "TRIGGER;RELATED=END:-PT15M")
+			writeICalLine(bw, "DESCRIPTION:"+escapeICalText(todo.Title))
+			writeICalLine(bw, "END:VALARM")
+		}
+
+		writeICalLine(bw, "END:VTODO")
+
+		return nil
+	})
+	if err != nil {
+		app.exportFailed(w, r, err, started)
+		return
+	}
+
+	start()
+	writeICalLine(bw, "END:VCALENDAR")
+
+	err = bw.Flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// escapeICalText escapes a TEXT value as described in RFC 5545, section 3.3.11.
+func escapeICalText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// writeICalLine writes a content line terminated by CRLF, folding it so no
+// physical line is longer than 75 octets (RFC 5545, section 3.1). Lines are
+// only split between UTF-8 characters. Write errors surface on Flush.
+func writeICalLine(bw *bufio.Writer, line string) {
+	limit := 75
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isUTF8Start(line[cut]) {
+			cut--
+		}
+
+		bw.WriteString(line[:cut])
+		bw.WriteString("\r\n ")
+		line = line[cut:]
+
+		// Continuation lines start with a space, which counts toward the limit.
+		limit = 74
+	}
+
+	bw.WriteString(line)
+	bw.WriteString("\r\n")
+}
+
+func isUTF8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
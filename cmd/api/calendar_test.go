@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscapeICalText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Buy milk", "Buy milk"},
+		{"Milk, bread; eggs", `Milk\, bread\; eggs`},
+		{`C:\todos`, `C:\\todos`},
+		{"First line\r\nsecond\nthird", `First line\nsecond\nthird`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeICalText(tt.text); got != tt.want {
+			t.Errorf("escapeICalText(%q): got %q; want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWriteICalLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		lines int
+	}{
+		{"short", "SUMMARY:Buy milk", 1},
+		{"at the limit", "SUMMARY:" + strings.Repeat("a", 67), 1},
+		{"folded", "SUMMARY:" + strings.Repeat("a", 200), 3},
+		{"multi-byte characters", "SUMMARY:" + strings.Repeat("é", 100), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+
+			bw := bufio.NewWriter(&sb)
+			writeICalLine(bw, tt.line)
+			bw.Flush()
+
+			out := sb.String()
+
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("got %q; want it terminated by CRLF", out)
+			}
+
+			physical := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+
+			if len(physical) != tt.lines {
+				t.Errorf("got %d lines; want %d", len(physical), tt.lines)
+			}
+
+			for i, line := range physical {
+				if len(line) > 75 {
+					t.Errorf("line %d is %d octets long; want at most 75", i, len(line))
+				}
+
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a UTF-8 character: %q", i, line)
+				}
+
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d doesn't start with a space: %q", i, line)
+				}
+			}
+
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != tt.line {
+				t.Errorf("unfolded to %q; want %q", unfolded, tt.line)
+			}
+		})
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	due := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	for _, todo := range []map[string]any{
+		{"title": "Pay rent", "due_date": due},
+		{"title": "Renew passport, urgently", "due_date": due.Add(time.Hour)},
+		{"title": "Someday"},
+	} {
+		if status := do(t, app, http.MethodPost, "/v1/todos", token, todo, nil); status != http.StatusCreated {
+			t.Fatalf("creating %v: got status %d; want %d", todo["title"], status, http.StatusCreated)
+		}
+	}
+
+	var response struct {
+		CalendarURL string `json:"calendar_url"`
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/users/me/calendar-token", token, nil, &response)
+	if status != http.StatusCreated {
+		t.Fatalf("creating the calendar token: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	feedURL, err := url.Parse(response.CalendarURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, feedURL.RequestURI(), nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/calendar") {
+		t.Errorf("got Content-Type %q; want text/calendar", got)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(rr.Body.String(), "\r\n ", ""), "\r\n"), "\r\n")
+
+	if lines[0] != "BEGIN:VCALENDAR" || lines[len(lines)-1] != "END:VCALENDAR" {
+		t.Errorf("got %q ... %q; want a VCALENDAR", lines[0], lines[len(lines)-1])
+	}
+
+	var summaries, dues []string
+
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "SUMMARY:"):
+			summaries = append(summaries, strings.TrimPrefix(line, "SUMMARY:"))
+		case strings.HasPrefix(line, "DUE:"):
+			dues = append(dues, strings.TrimPrefix(line, "DUE:"))
+		}
+	}
+
+	if got := strings.Count(rr.Body.String(), "BEGIN:VTODO"); got != 2 {
+		t.Errorf("got %d VTODOs; want 2", got)
+	}
+
+	if want := []string{"Pay rent", `Renew passport\, urgently`}; !slices.Equal(summaries, want) {
+		t.Errorf("got summaries %q; want %q", summaries, want)
+	}
+
+	if len(dues) != 2 || dues[0] != due.Format(icalTimeFormat) {
+		t.Errorf("got due dates %q; want the first to be %s", dues, due.Format(icalTimeFormat))
+	}
+
+	rr = httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/todos/calendar.ics?token="+token, nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("authentication token: got status %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadConfigFile applies the settings in a JSON config file to the flags in
+// fs. The file is an object keyed by flag name, e.g. {"port": 4000,
+// "limiter-rps": 5}. Flags given on the command line take precedence, so their
+// file values are skipped; the file in turn overrides the flag defaults,
+// including those read from .env.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.UseNumber()
+
+	var settings map[string]any
+
+	err = dec.Decode(&settings)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for name, value := range settings {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown setting %q", path, name)
+		}
+
+		if explicit[name] {
+			continue
+		}
+
+		s, err := configValueString(value)
+		if err != nil {
+			return fmt.Errorf("config file %s: setting %q: %w", path, name, err)
+		}
+
+		err = fs.Set(name, s)
+		if err != nil {
+			return fmt.Errorf("config file %s: setting %q: %w", path, name, err)
+		}
+	}
+
+	return nil
+}
+
+// configValueString turns a JSON value into the string form the flag package
+// parses. Lists are joined with commas, as for -trusted-proxy-cidrs.
+func configValueString(value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case []any:
+		parts := make([]string, len(value))
+
+		for i, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("list items must be strings")
+			}
+
+			parts[i] = s
+		}
+
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes contents to a config file in a temporary directory
+// and returns its path.
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	err := os.WriteFile(path, []byte(contents), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+type testConfig struct {
+	port    int
+	env     string
+	rps     float64
+	enabled bool
+	timeout time.Duration
+	origins string
+}
+
+func newTestFlagSet(cfg *testConfig) *flag.FlagSet {
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	fs.String("config", "", "")
+	fs.IntVar(&cfg.port, "port", 4000, "")
+	fs.StringVar(&cfg.env, "env", "development", "")
+	fs.Float64Var(&cfg.rps, "limiter-rps", 2, "")
+	fs.BoolVar(&cfg.enabled, "limiter-enabled", true, "")
+	fs.DurationVar(&cfg.timeout, "read-timeout", 5*time.Second, "")
+	fs.StringVar(&cfg.origins, "cors-trusted-origins", "", "")
+
+	return fs
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `{
+		"port": 8080,
+		"env": "production",
+		"limiter-rps": 5.5,
+		"limiter-enabled": false,
+		"read-timeout": "10s",
+		"cors-trusted-origins": ["https://a.example.com", "https://b.example.com"]
+	}`)
+
+	var cfg testConfig
+
+	fs := newTestFlagSet(&cfg)
+
+	err := fs.Parse([]string{"-port", "9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = loadConfigFile(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testConfig{
+		port:    9000,
+		env:     "production",
+		rps:     5.5,
+		enabled: false,
+		timeout: 10 * time.Second,
+		origins: "https://a.example.com,https://b.example.com",
+	}
+
+	if cfg != want {
+		t.Errorf("got %+v; want %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigFileInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"unknown setting", `{"colour": "blue"}`, `unknown setting "colour"`},
+		{"config setting", `{"config": "other.json"}`, `unknown setting "config"`},
+		{"invalid value", `{"port": "eighty"}`, `setting "port"`},
+		{"unsupported value", `{"env": {"name": "production"}}`, `setting "env"`},
+		{"non-string list item", `{"cors-trusted-origins": [1]}`, `setting "cors-trusted-origins"`},
+		{"invalid JSON", `{"port": `, "config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg testConfig
+
+			err := loadConfigFile(newTestFlagSet(&cfg), writeConfigFile(t, tt.contents))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v; want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
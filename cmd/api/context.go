@@ -6,21 +6,44 @@ import (
 	"net/http"
 )
 
+// contextKey is unexported so values set here can't collide with keys from
+// other packages, even ones using the same names.
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey       = contextKey("user")
+	requestIDContextKey  = contextKey("request_id")
+	queryStartContextKey = contextKey("query_start")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
 
+// contextGetUser must only be called behind protectedRouteMiddleware; a
+// missing user is a routing mistake, so it panics rather than returning nil.
 func (app *application) contextGetUser(r *http.Request) *data.User {
 	user, ok := r.Context().Value(userContextKey).(*data.User)
 
-	if !ok {
-		panic("missing user value in request constext")
+	if !ok || user == nil {
+		panic("missing user value in request context")
 	}
 
 	return user
 }
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, ok := r.Context().Value(requestIDContextKey).(string)
+
+	if !ok {
+		return ""
+	}
+
+	return requestID
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextUser(t *testing.T) {
+	app := newTestApplication(t)
+
+	user := &data.User{Id: 1, Email: "alice@example.com"}
+
+	r := app.contextSetUser(httptest.NewRequest(http.MethodGet, "/", nil), user)
+
+	if got := app.contextGetUser(r); got != user {
+		t.Errorf("got user %+v; want %+v", got, user)
+	}
+}
+
+func TestContextUserMissing(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name string
+		r    *http.Request
+	}{
+		{"not set", httptest.NewRequest(http.MethodGet, "/", nil)},
+		{"nil user", app.contextSetUser(httptest.NewRequest(http.MethodGet, "/", nil), nil)},
+		// A plain string key must not be mistaken for the user key.
+		{"colliding key", httptest.NewRequest(http.MethodGet, "/", nil).WithContext(context.WithValue(context.Background(), "user", &data.User{Id: 1}))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); err != "missing user value in request context" {
+					t.Errorf("got panic %v; want the missing user panic", err)
+				}
+			}()
+
+			app.contextGetUser(tt.r)
+		})
+	}
+}
+
+func TestContextRequestID(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if got := app.contextGetRequestID(r); got != "" {
+		t.Errorf("not set: got %q; want an empty request id", got)
+	}
+
+	r = app.contextSetRequestID(r, "0123456789abcdef")
+
+	if got := app.contextGetRequestID(r); got != "0123456789abcdef" {
+		t.Errorf("got %q; want %q", got, "0123456789abcdef")
+	}
+}
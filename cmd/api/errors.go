@@ -1,23 +1,28 @@
 package main
 
 import (
+	"GoTodo/internal/data"
+	"errors"
 	"fmt"
 	"net/http"
+	"runtime/debug"
+	"strings"
 )
 
 func (app *application) logError(r *http.Request, err error) {
 	var (
-		method = r.Method
-		uri    = r.URL.RequestURI()
+		method    = r.Method
+		uri       = r.URL.RequestURI()
+		requestID = app.contextGetRequestID(r)
 	)
 
-	app.logger.Error(err.Error(), "method", method, "uri", uri)
+	app.logger.Error(err.Error(), "method", method, "uri", uri, "request_id", requestID)
 }
 
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
 	env := envelope{"error": message}
 
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeJSON(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -31,22 +36,70 @@ func (app *application) invalidAuthenticationHeaderResponse(w http.ResponseWrite
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) accountLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many failed sign-in attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) registrationDisabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "registration is currently disabled"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) quotaExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "todo quota reached"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update record due to an edit conflict, please try again"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since it was last fetched"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
 
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	// Unless -debug is set the cause stays in the logs; it may reveal
+	// details about the database or internals that clients shouldn't see.
+	if !app.config.debug {
+		app.errorResponse(w, r, http.StatusInternalServerError, message)
+		return
+	}
+
+	detail := map[string]any{
+		"message": message,
+		"detail":  err.Error(),
+		"stack":   strings.Split(strings.TrimSpace(string(debug.Stack())), "\n"),
+	}
+
+	app.errorResponse(w, r, http.StatusInternalServerError, detail)
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
@@ -54,15 +107,90 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 	app.errorResponse(w, r, http.StatusNotFound, message)
 }
 
+// notFoundResponseFor reports that a specific resource, such as a todo, doesn't
+// exist, as opposed to notFoundResponse for unknown routes.
+func (app *application) notFoundResponseFor(w http.ResponseWriter, r *http.Request, resource string) {
+	message := fmt.Sprintf("the requested %s could not be found", resource)
+	app.errorResponse(w, r, http.StatusNotFound, message)
+}
+
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+
+	// httprouter sets the Allow header with the methods registered for the
+	// path before calling this handler.
+	allowedMethods := []string{}
+	for _, method := range strings.Split(w.Header().Get("Allow"), ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			allowedMethods = append(allowedMethods, method)
+		}
+	}
+
+	env := envelope{"error": message, "allowed_methods": allowedMethods}
+
+	err := app.writeJSON(w, r, http.StatusMethodNotAllowed, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLargeError *bodyTooLargeError
+	if errors.As(err, &tooLargeError) {
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	var mediaTypeError *unsupportedMediaTypeError
+	if errors.As(err, &mediaTypeError) {
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	var fieldErr *fieldError
+	if errors.As(err, &fieldErr) {
+		env := envelope{"error": fieldErr.message, "field": fieldErr.field}
+
+		err := app.writeJSON(w, r, http.StatusBadRequest, env, nil)
+		if err != nil {
+			app.logError(r, err)
+			w.WriteHeader(500)
+		}
+
+		return
+	}
+
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+// constraintViolationResponse reports a write the database rejected with a
+// check (422) or foreign key (409) violation.
+func (app *application) constraintViolationResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var constraintErr *data.ConstraintError
+	if !errors.As(err, &constraintErr) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if errors.Is(err, data.ErrForeignKeyViolation) {
+		message := "the request refers to a record that doesn't exist or is still in use"
+		app.errorResponse(w, r, http.StatusConflict, message)
+		return
+	}
+
+	field := constraintErr.Column
+	if field == "" {
+		field = constraintErr.Constraint
+	}
+
+	app.failedValidationResponse(w, r, map[string]string{field: fmt.Sprintf("violates the %s constraint", constraintErr.Constraint)})
+}
+
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
+
+func (app *application) failedBatchValidationResponse(w http.ResponseWriter, r *http.Request, errors map[int]map[string]string) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestServerErrorResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		debug  bool
+		detail bool
+	}{
+		{"debug", "development", true, true},
+		{"development", "development", false, false},
+		{"production", "production", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.env = tt.env
+			app.config.debug = tt.debug
+
+			var logs bytes.Buffer
+			app.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/todos", nil)
+
+			app.serverErrorResponse(rr, r, errors.New("connection to pg-internal:5432 refused"))
+
+			if !strings.Contains(logs.String(), "pg-internal") {
+				t.Errorf("the error wasn't logged: %s", logs.String())
+			}
+
+			if rr.Code != http.StatusInternalServerError {
+				t.Errorf("got status %d; want %d", rr.Code, http.StatusInternalServerError)
+			}
+
+			var body struct {
+				Error json.RawMessage `json:"error"`
+			}
+
+			err := json.Unmarshal(rr.Body.Bytes(), &body)
+			if err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+
+			if !tt.detail {
+				var message string
+
+				err = json.Unmarshal(body.Error, &message)
+				if err != nil {
+					t.Fatalf("got error %s; want a plain message", body.Error)
+				}
+
+				if strings.Contains(rr.Body.String(), "pg-internal") {
+					t.Errorf("response leaks the error: %s", rr.Body)
+				}
+
+				return
+			}
+
+			var detail struct {
+				Message string   `json:"message"`
+				Detail  string   `json:"detail"`
+				Stack   []string `json:"stack"`
+			}
+
+			err = json.Unmarshal(body.Error, &detail)
+			if err != nil {
+				t.Fatalf("got error %s; want details", body.Error)
+			}
+
+			if detail.Detail != "connection to pg-internal:5432 refused" {
+				t.Errorf("got detail %q; want the error", detail.Detail)
+			}
+
+			if len(detail.Stack) == 0 {
+				t.Error("response has no stack trace")
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowedResponse(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+
+	app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodPatch, "/v1/users", nil))
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+
+	// httprouter answers OPTIONS itself for every registered path.
+	if got, want := rr.Header().Get("Allow"), "OPTIONS, POST"; got != want {
+		t.Errorf("got Allow %q; want %q", got, want)
+	}
+
+	var response struct {
+		AllowedMethods []string `json:"allowed_methods"`
+	}
+
+	decode(t, rr, &response)
+
+	if want := []string{"OPTIONS", "POST"}; !slices.Equal(response.AllowedMethods, want) {
+		t.Errorf("got allowed methods %v; want %v", response.AllowedMethods, want)
+	}
+}
+
+func TestNotFoundResponses(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		want    string
+	}{
+		{"unknown route", app.routes().ServeHTTP, "/v1/nothing-here", "the requested resource could not be found"},
+		{"invalid todo id", app.showTodoHandler, "/v1/todos/abc", "the requested todo could not be found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response struct {
+				Error string `json:"error"`
+			}
+
+			status := doAs(t, app, tt.handler, &data.User{Id: 1}, http.MethodGet, tt.path, nil, &response)
+			if status != http.StatusNotFound {
+				t.Fatalf("got status %d; want %d", status, http.StatusNotFound)
+			}
+
+			if response.Error != tt.want {
+				t.Errorf("got error %q; want %q", response.Error, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintViolationResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantError  string
+	}{
+		{
+			"check violation",
+			&data.ConstraintError{Kind: data.ErrCheckViolation, Constraint: "todos_title_check", Column: "title"},
+			http.StatusUnprocessableEntity,
+			`{"title":"violates the todos_title_check constraint"}`,
+		},
+		{
+			"check violation without a column",
+			&data.ConstraintError{Kind: data.ErrCheckViolation, Constraint: "todos_title_check"},
+			http.StatusUnprocessableEntity,
+			`{"todos_title_check":"violates the todos_title_check constraint"}`,
+		},
+		{
+			"foreign key violation",
+			&data.ConstraintError{Kind: data.ErrForeignKeyViolation, Constraint: "todos_project_id_fkey", Column: "project_id"},
+			http.StatusConflict,
+			`"the request refers to a record that doesn't exist or is still in use"`,
+		},
+		{
+			"other error",
+			errors.New("connection reset"),
+			http.StatusInternalServerError,
+			`"the server encountered a problem and could not process your request"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			rr := httptest.NewRecorder()
+			app.constraintViolationResponse(rr, httptest.NewRequest(http.MethodPost, "/v1/todos", nil), tt.err)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+
+			var response struct {
+				Error json.RawMessage `json:"error"`
+			}
+
+			decode(t, rr, &response)
+
+			if string(response.Error) != tt.wantError {
+				t.Errorf("got error %s; want %s", response.Error, tt.wantError)
+			}
+		})
+	}
+}
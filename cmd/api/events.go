@@ -0,0 +1,149 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	todoEventCreated = "created"
+	todoEventUpdated = "updated"
+	todoEventDeleted = "deleted"
+)
+
+// sseKeepAliveInterval is how often an idle stream gets a comment line, so
+// proxies and load balancers don't close it for inactivity.
+const sseKeepAliveInterval = 15 * time.Second
+
+type todoEvent struct {
+	Type   string     `json:"type"`
+	TodoID int64      `json:"todo_id"`
+	Todo   *data.Todo `json:"todo,omitempty"`
+}
+
+// todoBroker fans todo changes out to the streams each user has open. It only
+// reaches subscribers connected to this process.
+type todoBroker struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan todoEvent]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func newTodoBroker() *todoBroker {
+	return &todoBroker{
+		subscribers: make(map[int64]map[chan todoEvent]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// shutdown ends every open stream.
+func (b *todoBroker) shutdown() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// subscribe registers a stream for the user's events. The returned function
+// unsubscribes it and must be called once the stream is done.
+func (b *todoBroker) subscribe(userId int64) (<-chan todoEvent, func()) {
+	ch := make(chan todoEvent, 16)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[userId] == nil {
+		b.subscribers[userId] = make(map[chan todoEvent]struct{})
+	}
+	b.subscribers[userId][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[userId], ch)
+		if len(b.subscribers[userId]) == 0 {
+			delete(b.subscribers, userId)
+		}
+	}
+}
+
+// publish delivers the event to the user's streams without blocking; a stream
+// that has fallen too far behind misses the event.
+func (b *todoBroker) publish(userId int64, event todoEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[userId] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// streamTodosHandler keeps the connection open and sends the user's todo
+// changes as server-sent events until the client disconnects or the server
+// shuts down.
+func (app *application) streamTodosHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	rc := http.NewResponseController(w)
+
+	// The stream is expected to outlive the server's write timeout.
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	events, unsubscribe := app.events.subscribe(user.Id)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// The initial comment gets the headers to the client right away.
+	_, err = fmt.Fprint(w, ": connected\n\n")
+	if err == nil {
+		err = rc.Flush()
+	}
+	if err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.events.done:
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			var js []byte
+			js, err = json.Marshal(event)
+			if err != nil {
+				app.logError(r, err)
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, js)
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
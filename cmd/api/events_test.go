@@ -0,0 +1,217 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTodoBroker(t *testing.T) {
+	broker := newTodoBroker()
+
+	alice, unsubscribeAlice := broker.subscribe(1)
+	bob, unsubscribeBob := broker.subscribe(2)
+	defer unsubscribeBob()
+
+	broker.publish(1, todoEvent{Type: todoEventCreated, TodoID: 10})
+
+	select {
+	case event := <-alice:
+		if event.Type != todoEventCreated || event.TodoID != 10 {
+			t.Errorf("got event %+v; want todo 10 created", event)
+		}
+	default:
+		t.Error("the subscriber didn't get the event")
+	}
+
+	select {
+	case event := <-bob:
+		t.Errorf("another user's subscriber got event %+v", event)
+	default:
+	}
+
+	unsubscribeAlice()
+
+	broker.mu.Lock()
+	_, ok := broker.subscribers[1]
+	broker.mu.Unlock()
+
+	if ok {
+		t.Error("the user is still subscribed after unsubscribing")
+	}
+
+	// A full stream misses events rather than blocking the publisher.
+	for i := range 32 {
+		broker.publish(2, todoEvent{Type: todoEventUpdated, TodoID: int64(i)})
+	}
+
+	if len(bob) != cap(bob) {
+		t.Errorf("got %d buffered events; want %d", len(bob), cap(bob))
+	}
+}
+
+// openStream connects to the todo stream at url and returns its lines, starting
+// after the initial connected comment.
+func openStream(t *testing.T, ctx context.Context, url, token string) <-chan string {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d; want %d", res.StatusCode, http.StatusOK)
+	}
+
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("got Content-Type %q; want text/event-stream", got)
+	}
+
+	lines := make(chan string)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	if got := nextMessage(t, lines); got != ": connected" {
+		t.Fatalf("got %q; want the connected comment", got)
+	}
+
+	return lines
+}
+
+// nextMessage returns the next server-sent event from lines, its lines joined
+// by newlines.
+func nextMessage(t *testing.T, lines <-chan string) string {
+	t.Helper()
+
+	var message []string
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("the stream ended")
+			}
+
+			if line == "" {
+				return strings.Join(message, "\n")
+			}
+
+			message = append(message, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+	}
+}
+
+func TestStreamTodos(t *testing.T) {
+	app := newTestApplication(t)
+
+	user := &data.User{Id: 1}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.streamTodosHandler(w, app.contextSetUser(r, user))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lines := openStream(t, ctx, ts.URL, "")
+
+	go app.events.publish(user.Id, todoEvent{Type: todoEventDeleted, TodoID: 7})
+
+	if got, want := nextMessage(t, lines), "event: deleted\ndata: {\"type\":\"deleted\",\"todo_id\":7}"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	cancel()
+
+	// Disconnecting unsubscribes the stream.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		app.events.mu.Lock()
+		subscribed := len(app.events.subscribers[user.Id]) > 0
+		app.events.mu.Unlock()
+
+		if !subscribed {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the stream is still subscribed after the client disconnected")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamTodosCreate(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	ts := httptest.NewServer(app.routes())
+	defer ts.Close()
+
+	lines := openStream(t, context.Background(), ts.URL+"/v1/todos/stream", token)
+
+	created := make(chan *httptest.ResponseRecorder, 1)
+
+	req := newRequest(t, http.MethodPost, "/v1/todos", map[string]any{"title": "Buy milk"})
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	go func() {
+		rr := httptest.NewRecorder()
+		app.routes().ServeHTTP(rr, req)
+		created <- rr
+	}()
+
+	message := nextMessage(t, lines)
+
+	rr := <-created
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("creating the todo: got status %d; want %d", rr.Code, http.StatusCreated)
+	}
+
+	var response todoResponse
+	decode(t, rr, &response)
+
+	id := response.Todo.ID
+
+	if !strings.HasPrefix(message, "event: created\ndata: ") {
+		t.Fatalf("got %q; want a created event", message)
+	}
+
+	if want := `"todo_id":` + strconv.FormatInt(id, 10); !strings.Contains(message, want) {
+		t.Errorf("got %q; want it to contain %s", message, want)
+	}
+
+	if !strings.Contains(message, `"title":"Buy milk"`) {
+		t.Errorf("got %q; want the created todo", message)
+	}
+}
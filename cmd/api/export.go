@@ -0,0 +1,319 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/data/validator"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (app *application) exportTodosHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Format    string
+		Search    string
+		Tags      []string
+		ProjectID *int64
+		data.Filters
+	}
+
+	qs := r.URL.Query()
+
+	input.Format = app.readString(qs, "format", "csv")
+	input.Search = strings.TrimSpace(app.readString(qs, "search", ""))
+	input.Tags = data.NormalizeTags(qs["tag"])
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(input.Format, "csv", "json"), "format", "must be csv or json")
+
+	data.ValidateSearch(v, input.Search)
+	data.ValidateTags(v, input.Tags)
+
+	if qs.Has("project_id") {
+		projectID := int64(app.readInt(qs, "project_id", 0, v))
+		v.Check(projectID > 0, "project_id", "must be greater than 0")
+		input.ProjectID = &projectID
+	}
+
+	input.Filters.Sort = app.readString(qs, "sort", "created_at")
+	input.Filters.Order = app.readString(qs, "order", "desc")
+	input.Filters.SortSafeList = []string{"is_completed", "due_date", "created_at", "title", "position", "smart"}
+	input.Filters.OrderSafeList = []string{"asc", "desc"}
+
+	if input.Search != "" {
+		input.Filters.SortSafeList = append(input.Filters.SortSafeList, "relevance")
+	} else if input.Filters.Sort == "relevance" {
+		input.Filters.Sort = "created_at"
+	}
+
+	if data.ValidateSort(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	switch input.Format {
+	case "json":
+		app.exportTodosJSON(w, r, user.Id, input.Search, input.Tags, input.ProjectID, input.Filters)
+	default:
+		app.exportTodosCSV(w, r, user.Id, input.Search, input.Tags, input.ProjectID, input.Filters)
+	}
+}
+
+func (app *application) exportTodosCSV(w http.ResponseWriter, r *http.Request, userId int64, search string, tags []string, projectId *int64, filters data.Filters) {
+	filename := fmt.Sprintf("todos-%s.csv", time.Now().UTC().Format("20060102"))
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	cw := csv.NewWriter(w)
+
+	// Nothing is written until the first row arrives, so a failing query can
+	// still be reported as a regular JSON error.
+	headerWritten := false
+
+	writeHeader := func() error {
+		if headerWritten {
+			return nil
+		}
+		headerWritten = true
+
+		return cw.Write([]string{"id", "title", "description", "due_date", "is_completed", "created_at"})
+	}
+
+	err := app.models.Todos.Export(r.Context(), userId, search, tags, projectId, filters, func(todo *data.Todo) error {
+		err := writeHeader()
+		if err != nil {
+			return err
+		}
+
+		dueDate := ""
+		if todo.DueDate != nil {
+			dueDate = todo.DueDate.Format(time.RFC3339)
+		}
+
+		return cw.Write([]string{
+			strconv.FormatInt(todo.ID, 10),
+			todo.Title,
+			todo.Description,
+			dueDate,
+			strconv.FormatBool(todo.IsCompleted),
+			todo.CreatedAt.Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		app.exportFailed(w, r, err, headerWritten)
+		return
+	}
+
+	err = writeHeader()
+	if err == nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) exportTodosJSON(w http.ResponseWriter, r *http.Request, userId int64, search string, tags []string, projectId *int64, filters data.Filters) {
+	filename := fmt.Sprintf("todos-%s.json", time.Now().UTC().Format("20060102"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	bw := bufio.NewWriter(w)
+	started := false
+
+	err := app.models.Todos.Export(r.Context(), userId, search, tags, projectId, filters, func(todo *data.Todo) error {
+		js, err := json.Marshal(todo)
+		if err != nil {
+			return err
+		}
+
+		separator := ",\n"
+		if !started {
+			separator = "[\n"
+			started = true
+		}
+
+		_, err = bw.WriteString(separator)
+		if err != nil {
+			return err
+		}
+
+		_, err = bw.Write(js)
+		return err
+	})
+	if err != nil {
+		app.exportFailed(w, r, err, started)
+		return
+	}
+
+	closing := "\n]\n"
+	if !started {
+		closing = "[]\n"
+	}
+
+	_, err = bw.WriteString(closing)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// exportFailed reports an error that happened while streaming an export. Once
+// part of the body has been written all that's left is to log the failure.
+func (app *application) exportFailed(w http.ResponseWriter, r *http.Request, err error, started bool) {
+	if started {
+		app.logError(r, err)
+		return
+	}
+
+	w.Header().Del("Content-Disposition")
+	app.serverErrorResponse(w, r, err)
+}
+
+func (app *application) importTodosHandler(w http.ResponseWriter, r *http.Request) {
+	var input []struct {
+		Title       string     `json:"title"`
+		Description string     `json:"description"`
+		DueDate     *time.Time `json:"due_date"`
+		IsCompleted bool       `json:"is_completed"`
+		Recurrence  string     `json:"recurrence"`
+		Tags        []string   `json:"tags"`
+		Subtasks    []struct {
+			ID          any    `json:"id"`
+			Title       string `json:"title"`
+			IsCompleted bool   `json:"is_completed"`
+			Position    any    `json:"position"`
+		} `json:"subtasks"`
+		Attachments []struct {
+			ID        any    `json:"id"`
+			CreatedAt any    `json:"created_at"`
+			URL       string `json:"url"`
+			Filename  string `json:"filename"`
+		} `json:"attachments"`
+
+		// These are part of an export but are assigned afresh on import (or,
+		// for project_id, belong to the exporting user), so they're accepted
+		// and ignored.
+		ID        any `json:"id"`
+		UserID    any `json:"user_id"`
+		ProjectID any `json:"project_id"`
+		Position  any `json:"position"`
+		CreatedAt any `json:"created_at"`
+		Version   any `json:"version"`
+		Shared    any `json:"shared"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(input) == 0 {
+		app.failedValidationResponse(w, r, map[string]string{"todos": "must contain at least one todo"})
+		return
+	}
+
+	todos := make([]*data.Todo, len(input))
+	batchErrors := make(map[int]map[string]string)
+
+	for i, item := range input {
+		if item.Recurrence == "" {
+			item.Recurrence = data.RecurrenceNone
+		}
+
+		if item.Tags == nil {
+			item.Tags = []string{}
+		}
+
+		todos[i] = &data.Todo{
+			Title:       strings.TrimSpace(item.Title),
+			Description: item.Description,
+			DueDate:     item.DueDate,
+			IsCompleted: item.IsCompleted,
+			Recurrence:  item.Recurrence,
+			Tags:        data.NormalizeTags(item.Tags),
+			Subtasks:    make([]data.Subtask, len(item.Subtasks)),
+			Attachments: make([]data.Attachment, len(item.Attachments)),
+		}
+
+		v := validator.New()
+
+		data.ValidateTodo(v, todos[i], app.todoValidationOptions(true))
+		data.ValidateTags(v, todos[i].Tags)
+
+		for j, subtask := range item.Subtasks {
+			todos[i].Subtasks[j] = data.Subtask{
+				Title:       subtask.Title,
+				IsCompleted: subtask.IsCompleted,
+			}
+
+			data.ValidateSubtask(v, &todos[i].Subtasks[j])
+		}
+
+		for j, attachment := range item.Attachments {
+			todos[i].Attachments[j] = data.Attachment{
+				URL:      attachment.URL,
+				Filename: attachment.Filename,
+			}
+
+			data.ValidateAttachment(v, &todos[i].Attachments[j])
+		}
+
+		if !v.Valid() {
+			batchErrors[i] = v.Errors
+		}
+	}
+
+	if len(batchErrors) > 0 {
+		app.failedBatchValidationResponse(w, r, batchErrors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.WithTx(r.Context(), func(m data.Models) error {
+		err := app.checkTodoQuota(r.Context(), m, user.Id, activeTodos(todos))
+		if err != nil {
+			return err
+		}
+
+		return m.Todos.Import(r.Context(), user.Id, todos)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	for _, todo := range todos {
+		app.audit(r, &user.Id, data.AuditTodoCreate, "todo", &todo.ID)
+		app.events.publish(user.Id, todoEvent{Type: todoEventCreated, TodoID: todo.ID, Todo: todo})
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"todos": todos}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
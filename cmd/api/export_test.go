@@ -0,0 +1,156 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// export fetches the user's todos in format and returns the recorded response.
+func export(t *testing.T, app *application, token, format string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := newRequest(t, http.MethodGet, "/v1/todos/export?format="+format, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rr := httptest.NewRecorder()
+
+	app.routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("exporting %s: got status %d; want %d", format, rr.Code, http.StatusOK)
+	}
+
+	return rr
+}
+
+func TestExportTodosCSV(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	for i := range 3 {
+		body := map[string]any{"title": fmt.Sprintf("Todo %d", i), "description": "with a comma, and \"quotes\""}
+
+		if status := do(t, app, http.MethodPost, "/v1/todos", token, body, nil); status != http.StatusCreated {
+			t.Fatalf("creating todo %d: got status %d; want %d", i, status, http.StatusCreated)
+		}
+	}
+
+	rr := export(t, app, token, "csv")
+
+	if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("got Content-Type %q; want text/csv", got)
+	}
+
+	if got := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment;") {
+		t.Errorf("got Content-Disposition %q; want an attachment", got)
+	}
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parsing the CSV: %v", err)
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("got %d records; want a header and 3 rows", len(records))
+	}
+
+	header := []string{"id", "title", "description", "due_date", "is_completed", "created_at"}
+	if !slices.Equal(records[0], header) {
+		t.Errorf("got header %v; want %v", records[0], header)
+	}
+
+	for _, record := range records[1:] {
+		if record[2] != "with a comma, and \"quotes\"" {
+			t.Errorf("got description %q; want it unchanged", record[2])
+		}
+	}
+}
+
+func TestExportImportTodosJSON(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	dueDate := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+
+	todos := []map[string]any{
+		{"title": "Buy milk", "tags": []string{"errands"}},
+		{"title": "File taxes", "description": "Before the deadline", "due_date": dueDate},
+		{"title": "Water the plants", "recurrence": data.RecurrenceWeekly, "due_date": dueDate},
+	}
+
+	for _, todo := range todos {
+		if status := do(t, app, http.MethodPost, "/v1/todos", alice, todo, nil); status != http.StatusCreated {
+			t.Fatalf("creating %v: got status %d; want %d", todo, status, http.StatusCreated)
+		}
+	}
+
+	exported := export(t, app, alice, "json")
+
+	status := do(t, app, http.MethodPost, "/v1/todos/import", bob, json.RawMessage(exported.Body.Bytes()), nil)
+	if status != http.StatusCreated {
+		t.Fatalf("importing: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	want := exportedTodos(t, exported)
+	got := exportedTodos(t, export(t, app, bob, "json"))
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if ids := listTodos(t, app, alice, "").Todos; len(ids) != len(todos) {
+		t.Errorf("exporting user: got %d todos; want %d", len(ids), len(todos))
+	}
+}
+
+// exportedTodo holds the parts of an exported todo that an import reproduces.
+type exportedTodo struct {
+	Title       string
+	Description string
+	DueDate     string
+	IsCompleted bool
+	Recurrence  string
+	Tags        string
+}
+
+// exportedTodos decodes a JSON export, sorted by title.
+func exportedTodos(t *testing.T, rr *httptest.ResponseRecorder) []exportedTodo {
+	t.Helper()
+
+	var todos []data.Todo
+
+	decode(t, rr, &todos)
+
+	var result []exportedTodo
+
+	for _, todo := range todos {
+		e := exportedTodo{
+			Title:       todo.Title,
+			Description: todo.Description,
+			IsCompleted: todo.IsCompleted,
+			Recurrence:  todo.Recurrence,
+			Tags:        strings.Join(todo.Tags, ","),
+		}
+
+		if todo.DueDate != nil {
+			e.DueDate = todo.DueDate.UTC().Format(time.RFC3339)
+		}
+
+		result = append(result, e)
+	}
+
+	slices.SortFunc(result, func(a, b exportedTodo) int { return strings.Compare(a.Title, b.Title) })
+
+	return result
+}
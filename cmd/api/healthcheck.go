@@ -1,19 +1,144 @@
 package main
 
 import (
+	"GoTodo/internal/data"
+	"context"
+	"errors"
 	"net/http"
+	"runtime/debug"
+	"time"
 )
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
-	data := map[string]string{
-		"status":      "available",
+	status := "available"
+	database := "available"
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	err := app.db.Ping(ctx)
+	if err != nil {
+		app.logError(r, err)
+		status = "degraded"
+		database = "unavailable"
+	}
+
+	stats := app.db.Stat()
+
+	data := map[string]any{
+		"status":      status,
 		"environment": app.config.env,
 		"version":     version,
+		"database":    database,
+		"database_pool": map[string]int32{
+			"total_conns":    stats.TotalConns(),
+			"idle_conns":     stats.IdleConns(),
+			"acquired_conns": stats.AcquiredConns(),
+		},
 	}
 
-	err := app.writeJSON(w, http.StatusOK, envelope{"server_info": data}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"server_info": data}, nil)
 	if err != nil {
 		app.logger.Error(err.Error())
 		http.Error(w, "The server encountered a problem and could not process your request", http.StatusInternalServerError)
 	}
 }
+
+// livenessHandler reports that the process is up. It deliberately doesn't
+// touch the database, so a database outage doesn't get the process restarted.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, r, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler reports whether the server can take traffic: the database
+// has to answer a ping and the pool needs a connection to spare.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"database":      "available",
+		"database_pool": "available",
+	}
+	status := http.StatusOK
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	err := app.db.Ping(ctx)
+	if err != nil {
+		app.logError(r, err)
+		checks["database"] = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	stats := app.db.Stat()
+	if stats.AcquiredConns() >= stats.MaxConns() {
+		checks["database_pool"] = "exhausted"
+		status = http.StatusServiceUnavailable
+	}
+
+	readiness := "ready"
+	if status != http.StatusOK {
+		readiness = "not ready"
+	}
+
+	err = app.writeJSON(w, r, status, envelope{"status": readiness, "checks": checks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// schemaVersionHandler reports the database's migration version, responding
+// with 503 when it's behind what this build expects or a migration failed
+// part way through.
+func (app *application) schemaVersionHandler(w http.ResponseWriter, r *http.Request) {
+	current, dirty, err := app.models.Schema.Version(r.Context())
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if current < schemaVersion || dirty {
+		status = http.StatusServiceUnavailable
+	}
+
+	info := map[string]any{
+		"current":  current,
+		"expected": schemaVersion,
+		"dirty":    dirty,
+	}
+
+	err = app.writeJSON(w, r, status, envelope{"schema_version": info}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) versionHandler(w http.ResponseWriter, r *http.Request) {
+	info := map[string]string{
+		"version":     version,
+		"environment": app.config.env,
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		info["go_version"] = buildInfo.GoVersion
+
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info["vcs_revision"] = setting.Value
+			case "vcs.time":
+				info["build_time"] = setting.Value
+			case "vcs.modified":
+				info["vcs_modified"] = setting.Value
+			}
+		}
+	}
+
+	err := app.writeJSON(w, r, http.StatusOK, envelope{"version_info": info}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// newClosedPool returns a pool that fails every ping, standing in for a
+// database that's down.
+func newClosedPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	pool, err := pgxpool.New(context.Background(), "postgres://postgres@localhost:1/gotodo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Close()
+
+	return pool
+}
+
+func TestHealthcheckDatabaseUnavailable(t *testing.T) {
+	app := newTestApplication(t)
+	app.db = newClosedPool(t)
+
+	rr := httptest.NewRecorder()
+	app.healthcheckHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	var response struct {
+		ServerInfo struct {
+			Status   string `json:"status"`
+			Database string `json:"database"`
+		} `json:"server_info"`
+	}
+
+	decode(t, rr, &response)
+
+	if response.ServerInfo.Database != "unavailable" {
+		t.Errorf("got database %q; want %q", response.ServerInfo.Database, "unavailable")
+	}
+
+	if response.ServerInfo.Status != "degraded" {
+		t.Errorf("got status %q; want %q", response.ServerInfo.Status, "degraded")
+	}
+}
+
+func TestProbes(t *testing.T) {
+	tests := []struct {
+		name      string
+		readiness bool
+		healthy   bool
+		want      int
+	}{
+		{"liveness with the database up", false, true, http.StatusOK},
+		{"liveness with the database down", false, false, http.StatusOK},
+		{"readiness with the database up", true, true, http.StatusOK},
+		{"readiness with the database down", true, false, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var app *application
+
+			if tt.healthy {
+				app = newTestDBApplication(t)
+			} else {
+				app = newTestApplication(t)
+				app.db = newClosedPool(t)
+			}
+
+			handler := app.livenessHandler
+			if tt.readiness {
+				handler = app.readinessHandler
+			}
+
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != tt.want {
+				t.Errorf("got status %d; want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	var response struct {
+		VersionInfo map[string]string `json:"version_info"`
+	}
+
+	decode(t, rr, &response)
+
+	if got := response.VersionInfo["version"]; got != version {
+		t.Errorf("got version %q; want %q", got, version)
+	}
+
+	if got := response.VersionInfo["environment"]; got != app.config.env {
+		t.Errorf("got environment %q; want %q", got, app.config.env)
+	}
+}
+
+// schemaMigrationsDB answers every query with the row golang-migrate would
+// keep in schema_migrations, or with err.
+type schemaMigrationsDB struct {
+	data.DBTX
+	version int64
+	dirty   bool
+	err     error
+}
+
+func (db schemaMigrationsDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return db
+}
+
+func (db schemaMigrationsDB) Scan(dest ...any) error {
+	if db.err != nil {
+		return db.err
+	}
+
+	reflect.ValueOf(dest[0]).Elem().SetInt(db.version)
+	reflect.ValueOf(dest[1]).Elem().SetBool(db.dirty)
+
+	return nil
+}
+
+func TestSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		db          schemaMigrationsDB
+		wantStatus  int
+		wantCurrent int64
+	}{
+		{"up to date", schemaMigrationsDB{version: schemaVersion}, http.StatusOK, schemaVersion},
+		{"behind", schemaMigrationsDB{version: schemaVersion - 1}, http.StatusServiceUnavailable, schemaVersion - 1},
+		{"dirty", schemaMigrationsDB{version: schemaVersion, dirty: true}, http.StatusServiceUnavailable, schemaVersion},
+		{"never migrated", schemaMigrationsDB{err: pgx.ErrNoRows}, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.models.Schema = data.SchemaModel{DB: tt.db}
+
+			rr := httptest.NewRecorder()
+			app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/debug/schema-version", nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+
+			var response struct {
+				SchemaVersion struct {
+					Current  int64 `json:"current"`
+					Expected int64 `json:"expected"`
+					Dirty    bool  `json:"dirty"`
+				} `json:"schema_version"`
+			}
+
+			decode(t, rr, &response)
+
+			got := response.SchemaVersion
+			if got.Current != tt.wantCurrent || got.Expected != schemaVersion || got.Dirty != tt.db.dirty {
+				t.Errorf("got %+v; want current %d, expected %d, dirty %t", got, tt.wantCurrent, schemaVersion, tt.db.dirty)
+			}
+		})
+	}
+}
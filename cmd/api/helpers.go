@@ -1,23 +1,71 @@
 package main
 
 import (
+	"GoTodo/internal/data"
 	"GoTodo/internal/data/validator"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 type envelope map[string]any
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e *bodyTooLargeError) Error() string {
+	return fmt.Sprintf("body must not be larger than %d bytes", e.limit)
+}
+
+type unsupportedMediaTypeError struct {
+	contentType string
+}
+
+func (e *unsupportedMediaTypeError) Error() string {
+	if e.contentType == "" {
+		return "body must be sent with Content-Type application/json"
+	}
+
+	return fmt.Sprintf("unsupported media type %q, body must be sent as application/json", e.contentType)
+}
+
+// fieldError is a request body error that can be pinned to a single field, so
+// clients can point at the offending input.
+type fieldError struct {
+	field   string
+	message string
+}
+
+func (e *fieldError) Error() string {
+	return e.message
+}
+
+// writeJSON sends data as the JSON response. Output is compact, except in
+// development or when the client asks for ?pretty=true.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	var js []byte
+	var err error
+
+	if app.prettyJSON(r) {
+		js, err = json.MarshalIndent(data, "", "  ")
+	} else {
+		js, err = json.Marshal(data)
+	}
 	if err != nil {
 		return err
 	}
@@ -35,19 +83,37 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+func (app *application) prettyJSON(r *http.Request) bool {
+	pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	if err != nil {
+		return app.config.env == "development"
+	}
+
+	return pretty
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
-	const ONE_MEGABYTE = 1_048_576
+	err := app.checkContentType(r)
+	if err != nil {
+		return err
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.maxBodyBytes)
+
+	// The body is kept as it's read since errors from time.Time, which
+	// decodes itself, don't say which field they came from.
+	var body bytes.Buffer
 
-	r.Body = http.MaxBytesReader(w, r.Body, ONE_MEGABYTE)
-	dec := json.NewDecoder(r.Body)
+	dec := json.NewDecoder(io.TeeReader(r.Body, &body))
 	dec.DisallowUnknownFields()
 
-	err := dec.Decode(dst)
+	err = dec.Decode(dst)
 	if err != nil {
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
 		var maxBytesError *http.MaxBytesError
+		var parseError *time.ParseError
 
 		switch {
 		case errors.As(err, &syntaxError):
@@ -56,16 +122,30 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 			return errors.New("body contains badly-formed JSON")
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return &fieldError{
+					field:   unmarshalTypeError.Field,
+					message: fmt.Sprintf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field),
+				}
 			}
 			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.As(err, &parseError), strings.HasPrefix(err.Error(), "Time.UnmarshalJSON: "):
+			if field := invalidTimeField(body.Bytes(), dst); field != "" {
+				return &fieldError{
+					field:   field,
+					message: fmt.Sprintf("body contains an invalid date for field %q, use RFC 3339 format", field),
+				}
+			}
+			return errors.New("body contains an invalid date, use RFC 3339 format")
 		case errors.Is(err, io.EOF):
 			return errors.New("body must not be empty")
-		case strings.HasPrefix(err.Error(), "json: unkown field"):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unkown field")
-			return fmt.Errorf("body has unkown key %s", fieldName)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return &fieldError{
+				field:   fieldName,
+				message: fmt.Sprintf("body contains unknown key %q", fieldName),
+			}
 		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+			return &bodyTooLargeError{limit: maxBytesError.Limit}
 		case errors.As(err, &invalidUnmarshalError):
 			panic(err)
 		default:
@@ -82,6 +162,109 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+// invalidTimeField returns the path of the first time field in dst whose value
+// in the JSON document at the start of js doesn't decode, with keys joined by
+// dots and array indexes left out as in json.UnmarshalTypeError. It returns ""
+// if there's no such field.
+func invalidTimeField(js []byte, dst any) string {
+	var document any
+
+	err := json.NewDecoder(bytes.NewReader(js)).Decode(&document)
+	if err != nil {
+		return ""
+	}
+
+	return findInvalidTime(document, reflect.TypeOf(dst), "")
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func findInvalidTime(node any, t reflect.Type, path string) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		switch node := node.(type) {
+		case nil:
+			return ""
+		case string:
+			_, err := time.Parse(time.RFC3339, node)
+			if err == nil {
+				return ""
+			}
+		}
+
+		return path
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		elements, _ := node.([]any)
+
+		for _, element := range elements {
+			if field := findInvalidTime(element, t.Elem(), path); field != "" {
+				return field
+			}
+		}
+	case reflect.Struct:
+		object, _ := node.(map[string]any)
+
+		for i := range t.NumField() {
+			structField := t.Field(i)
+			if !structField.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = structField.Name
+			}
+
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			value, ok := object[name]
+			if !ok {
+				continue
+			}
+
+			if field := findInvalidTime(value, structField.Type, fieldPath); field != "" {
+				return field
+			}
+		}
+	}
+
+	return ""
+}
+
+// checkContentType rejects request bodies that aren't sent as JSON. A missing
+// Content-Type is treated as JSON unless the server requires the header.
+func (app *application) checkContentType(r *http.Request) error {
+	contentType := r.Header.Get("Content-Type")
+
+	if contentType == "" {
+		if app.config.requireContentType {
+			return &unsupportedMediaTypeError{}
+		}
+
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/json" {
+		return &unsupportedMediaTypeError{contentType: contentType}
+	}
+
+	return nil
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 
@@ -107,6 +290,181 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readIDList(qs url.Values, key string, v *validator.Validator) []int64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return []int64{}
+	}
+
+	parts := strings.Split(s, ",")
+	ids := make([]int64, 0, len(parts))
+
+	for _, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id < 1 {
+			v.AddError(key, "must be a comma-separated list of positive integers")
+			return nil
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// readFields reads a comma-separated list of field names, each of which has to
+// be in safeList. It returns nil when the parameter isn't set.
+func (app *application) readFields(qs url.Values, key string, safeList []string, v *validator.Validator) []string {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	fields := strings.Split(s, ",")
+
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+
+		if !validator.PermittedValue(fields[i], safeList...) {
+			v.AddError(key, fmt.Sprintf("must only contain the following fields: %s", strings.Join(safeList, ", ")))
+			return nil
+		}
+	}
+
+	return fields
+}
+
+// selectFields trims value, a JSON object or array of objects once encoded, down
+// to the given fields. Without fields, value is returned as is.
+func selectFields(value any, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return value, nil
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	pick := func(object map[string]json.RawMessage) map[string]json.RawMessage {
+		selected := make(map[string]json.RawMessage, len(fields))
+
+		for _, field := range fields {
+			if raw, ok := object[field]; ok {
+				selected[field] = raw
+			}
+		}
+
+		return selected
+	}
+
+	if len(js) > 0 && js[0] == '[' {
+		var objects []map[string]json.RawMessage
+
+		err = json.Unmarshal(js, &objects)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range objects {
+			objects[i] = pick(objects[i])
+		}
+
+		return objects, nil
+	}
+
+	var object map[string]json.RawMessage
+
+	err = json.Unmarshal(js, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	return pick(object), nil
+}
+
+// absoluteURL turns path into an absolute URL on the host the request was sent
+// to. X-Forwarded-Proto and X-Forwarded-Host are only honoured when the
+// request comes from a trusted proxy. Without a known host, path is returned
+// as is.
+func (app *application) absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host := r.Host
+
+	if app.fromTrustedProxy(r) {
+		if proto := firstHeaderValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+
+		if forwardedHost := firstHeaderValue(r.Header.Get("X-Forwarded-Host")); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+
+	if host == "" {
+		return path
+	}
+
+	return (&url.URL{Scheme: scheme, Host: host, Path: path}).String()
+}
+
+// firstHeaderValue returns the first entry of a comma-separated header, which
+// for the X-Forwarded-* headers is the one set by the proxy closest to the
+// client.
+func firstHeaderValue(header string) string {
+	value, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(value)
+}
+
+func (app *application) readDuration(qs url.Values, key string, defaultValue time.Duration, v *validator.Validator) time.Duration {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		v.AddError(key, "must be a duration such as 24h or 90m")
+	}
+
+	return d
+}
+
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp such as 2024-01-02T15:04:05Z")
+	}
+
+	return t
+}
+
+func (app *application) readSessionIDParam(r *http.Request) (string, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id := params.ByName("id")
+
+	_, err := hex.DecodeString(id)
+	if err != nil || len(id) != 16 {
+		return "", errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
 func (app *application) readIDParam(r *http.Request) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
@@ -118,3 +476,136 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 
 	return id, nil
 }
+
+// readNamedIDParam reads a positive id from the named route parameter, for
+// routes that carry more than one id (e.g. /v1/todos/:id/subtasks/:subtask_id).
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
+
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return id, nil
+}
+
+func (app *application) readBearerToken(r *http.Request) (string, bool) {
+	authorizationHeader := r.Header.Get("Authorization")
+
+	if authorizationHeader == "" {
+		return "", false
+	}
+
+	headerParts := strings.Split(authorizationHeader, " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return "", false
+	}
+
+	return headerParts[1], true
+}
+
+// todoValidationOptions returns the configured todo limits. Past due dates are
+// only accepted when allowPastDueDate is set, e.g. for an unchanged due date.
+func (app *application) todoValidationOptions(allowPastDueDate bool) data.ValidateTodoOptions {
+	return data.ValidateTodoOptions{
+		MaxTitleLength:       app.config.todos.maxTitleLength,
+		MaxDescriptionLength: app.config.todos.maxDescriptionLength,
+		RequireDueDate:       app.config.todos.requireDueDate,
+		AllowPastDueDate:     allowPastDueDate,
+	}
+}
+
+// checkTodoQuota returns data.ErrQuotaExceeded if n more active todos would
+// take the user past the configured maximum. Completed todos don't count. It
+// has to be called with the models of the transaction that makes the change,
+// since it locks the user until that commits so concurrent requests can't
+// both pass the check.
+func (app *application) checkTodoQuota(ctx context.Context, models data.Models, userId int64, n int) error {
+	if app.config.todos.maxPerUser == 0 {
+		return nil
+	}
+
+	err := models.Users.Lock(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	count, err := models.Todos.CountForUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if count+n > app.config.todos.maxPerUser {
+		return data.ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// activeTodos counts the todos that aren't completed.
+func activeTodos(todos []*data.Todo) int {
+	n := 0
+
+	for _, todo := range todos {
+		if !todo.IsCompleted {
+			n++
+		}
+	}
+
+	return n
+}
+
+// todoETag builds a strong ETag from the todo's id and version, which is
+// incremented on every update.
+func todoETag(todo *data.Todo) string {
+	return fmt.Sprintf(`"%d-%d"`, todo.ID, todo.Version)
+}
+
+// etagMatches reports whether etag is listed in the value of an If-Match or
+// If-None-Match header.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	// Set the version (4) and variant (RFC 4122) bits of a UUID.
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// background runs fn in its own goroutine, logging a panic instead of letting
+// it take the server down. Shutdown waits for these goroutines to finish.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprintf("%v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadJSONFieldErrors(t *testing.T) {
+	type todoInput struct {
+		Title   string     `json:"title"`
+		DueDate *time.Time `json:"due_date"`
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		dst   any
+		field string
+	}{
+		{"unparsable due_date", `{"title": "Buy milk", "due_date": "tomorrow"}`, &todoInput{}, "due_date"},
+		{"due_date of the wrong type", `{"due_date": 5}`, &todoInput{}, "due_date"},
+		{"due_date in a batch", `[{"due_date": "2030-01-02T15:04:05Z"}, {"due_date": "2030-13-45"}]`, &[]todoInput{}, "due_date"},
+		{"title of the wrong type", `{"title": 5}`, &todoInput{}, "title"},
+		{"unknown key", `{"priority": 1}`, &todoInput{}, "priority"},
+		{"badly-formed JSON", `{"title": `, &todoInput{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/todos", strings.NewReader(tt.body))
+
+			err := app.readJSON(rr, r, tt.dst)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+
+			app.badRequestResponse(rr, r, err)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("got status %d; want %d", rr.Code, http.StatusBadRequest)
+			}
+
+			var response map[string]string
+
+			err = json.Unmarshal(rr.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+
+			if response["error"] == "" {
+				t.Errorf("response has no error message: %s", rr.Body)
+			}
+
+			if response["field"] != tt.field {
+				t.Errorf("got field %q; want %q", response["field"], tt.field)
+			}
+		})
+	}
+}
+
+func TestReadJSONBodyTooLarge(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.maxBodyBytes = 64
+
+	body := map[string]string{"title": strings.Repeat("a", 1024)}
+
+	var response struct {
+		Error string `json:"error"`
+	}
+
+	status := doAs(t, app, app.createTodoHandler, &data.User{Id: 1}, http.MethodPost, "/v1/todos", body, &response)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got status %d; want %d", status, http.StatusRequestEntityTooLarge)
+	}
+
+	if want := "body must not be larger than 64 bytes"; response.Error != want {
+		t.Errorf("got error %q; want %q", response.Error, want)
+	}
+}
+
+func TestReadJSONContentType(t *testing.T) {
+	tests := []struct {
+		name               string
+		contentType        string
+		requireContentType bool
+		wantStatus         int
+	}{
+		{"form-encoded", "application/x-www-form-urlencoded", false, http.StatusUnsupportedMediaType},
+		{"plain text", "text/plain", false, http.StatusUnsupportedMediaType},
+		{"JSON", "application/json", false, 0},
+		{"JSON with charset", "application/json; charset=utf-8", false, 0},
+		{"missing", "", false, 0},
+		{"missing when required", "", true, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.requireContentType = tt.requireContentType
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/todos", strings.NewReader(`{"title": "Buy milk"}`))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			var input struct {
+				Title string `json:"title"`
+			}
+
+			err := app.readJSON(rr, r, &input)
+
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("got error %v; want nil", err)
+				}
+
+				if input.Title != "Buy milk" {
+					t.Errorf("got title %q; want %q", input.Title, "Buy milk")
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatal("got no error")
+			}
+
+			app.badRequestResponse(rr, r, err)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	todo := &data.Todo{ID: 1, Title: "Buy milk", IsCompleted: true, Recurrence: data.RecurrenceNone}
+
+	tests := []struct {
+		name   string
+		value  any
+		fields []string
+		want   string
+	}{
+		{"object", todo, []string{"id", "title"}, `{"id":1,"title":"Buy milk"}`},
+		{"array", []*data.Todo{todo, {ID: 2, Title: "Walk the dog"}}, []string{"id", "is_completed"}, `[{"id":1,"is_completed":true},{"id":2,"is_completed":false}]`},
+		{"missing field", todo, []string{"id", "due_date"}, `{"id":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := selectFields(tt.value, tt.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			js, err := json.Marshal(selected)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(js) != tt.want {
+				t.Errorf("got %s; want %s", js, tt.want)
+			}
+		})
+	}
+
+	if got, _ := selectFields(todo, nil); got != todo {
+		t.Errorf("without fields: got %v; want the value as is", got)
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		host       string
+		remoteAddr string
+		forwarded  bool
+		want       string
+	}{
+		{"unknown host", "", "192.0.2.1:1234", false, "/v1/todos/1"},
+		{"host", "example.com", "192.0.2.1:1234", false, "http://example.com/v1/todos/1"},
+		{"forwarded by a trusted proxy", "internal:4000", "10.0.0.1:1234", true, "https://api.example.com/v1/todos/1"},
+		{"forwarded by anyone else", "example.com", "192.0.2.1:1234", true, "http://example.com/v1/todos/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/todos", nil)
+			r.Host = tt.host
+			r.RemoteAddr = tt.remoteAddr
+
+			if tt.forwarded {
+				r.Header.Set("X-Forwarded-Proto", "https")
+				r.Header.Set("X-Forwarded-Host", "api.example.com")
+			}
+
+			if got := app.absoluteURL(r, "/v1/todos/1"); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONPretty(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		query  string
+		pretty bool
+	}{
+		{"default", "production", "", false},
+		{"pretty", "production", "?pretty=true", true},
+		{"development default", "development", "", true},
+		{"compact in development", "development", "?pretty=false", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.env = tt.env
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/version"+tt.query, nil)
+
+			err := app.writeJSON(rr, r, http.StatusOK, envelope{"todo": map[string]any{"title": "Buy milk"}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := `{"todo":{"title":"Buy milk"}}` + "\n"
+			if tt.pretty {
+				want = "{\n  \"todo\": {\n    \"title\": \"Buy milk\"\n  }\n}\n"
+			}
+
+			if got := rr.Body.String(); got != want {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBackgroundPanic(t *testing.T) {
+	var buf bytes.Buffer
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	app.background(func() {
+		panic("something went wrong")
+	})
+
+	app.wg.Wait()
+
+	if out := buf.String(); !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "something went wrong") {
+		t.Errorf("got log %q; want the panic logged as an error", out)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type loginAttempt struct {
+	failures     int
+	firstFailure time.Time
+	lockedUntil  time.Time
+}
+
+// loginLimiter tracks failed sign-in attempts per email and locks the email
+// out for a cooldown period after too many consecutive failures.
+type loginLimiter struct {
+	mu          sync.Mutex
+	maxAttempts int
+	window      time.Duration
+	lockout     time.Duration
+	attempts    map[string]*loginAttempt
+}
+
+func newLoginLimiter(maxAttempts int, window, lockout time.Duration) *loginLimiter {
+	return &loginLimiter{
+		maxAttempts: maxAttempts,
+		window:      window,
+		lockout:     lockout,
+		attempts:    make(map[string]*loginAttempt),
+	}
+}
+
+func (l *loginLimiter) locked(email string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	attempt, found := l.attempts[strings.ToLower(email)]
+
+	return found && time.Now().Before(attempt.lockedUntil)
+}
+
+func (l *loginLimiter) recordFailure(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	key := strings.ToLower(email)
+
+	if len(l.attempts) > 10_000 {
+		l.prune(now)
+	}
+
+	attempt, found := l.attempts[key]
+	if !found || now.Sub(attempt.firstFailure) > l.window && now.After(attempt.lockedUntil) {
+		attempt = &loginAttempt{firstFailure: now}
+		l.attempts[key] = attempt
+	}
+
+	attempt.failures++
+
+	if attempt.failures >= l.maxAttempts {
+		attempt.lockedUntil = now.Add(l.lockout)
+		attempt.failures = 0
+		attempt.firstFailure = now
+	}
+}
+
+func (l *loginLimiter) reset(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, strings.ToLower(email))
+}
+
+func (l *loginLimiter) prune(now time.Time) {
+	for key, attempt := range l.attempts {
+		if now.Sub(attempt.firstFailure) > l.window && now.After(attempt.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
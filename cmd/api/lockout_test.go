@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	limiter := newLoginLimiter(3, time.Minute, time.Minute)
+
+	for range 2 {
+		limiter.recordFailure("alice@example.com")
+	}
+
+	if limiter.locked("alice@example.com") {
+		t.Fatal("locked before reaching the maximum attempts")
+	}
+
+	limiter.recordFailure("ALICE@example.com")
+
+	if !limiter.locked("alice@example.com") {
+		t.Error("not locked after the maximum attempts")
+	}
+
+	if limiter.locked("bob@example.com") {
+		t.Error("locked an email without failures")
+	}
+}
+
+func TestLoginLimiterReset(t *testing.T) {
+	limiter := newLoginLimiter(3, time.Minute, time.Minute)
+
+	for range 2 {
+		limiter.recordFailure("alice@example.com")
+	}
+
+	limiter.reset("alice@example.com")
+
+	for range 2 {
+		limiter.recordFailure("alice@example.com")
+	}
+
+	if limiter.locked("alice@example.com") {
+		t.Error("locked although a successful sign-in reset the failures")
+	}
+}
+
+func TestLoginLimiterWindow(t *testing.T) {
+	limiter := newLoginLimiter(2, 50*time.Millisecond, time.Minute)
+
+	limiter.recordFailure("alice@example.com")
+
+	time.Sleep(100 * time.Millisecond)
+
+	limiter.recordFailure("alice@example.com")
+
+	if limiter.locked("alice@example.com") {
+		t.Error("locked by failures outside the window")
+	}
+}
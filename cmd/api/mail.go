@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+)
+
+// emailSender is implemented by mailer.Mailer, and by logMailer when no SMTP
+// server is configured.
+type emailSender interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// logMailer stands in for the SMTP mailer when -smtp-host isn't set. Emails
+// are only logged; the template data, which holds tokens, is included in
+// development only, so the flows that depend on email stay usable locally.
+type logMailer struct {
+	logger *slog.Logger
+	debug  bool
+}
+
+func (m logMailer) Send(recipient, templateFile string, data any) error {
+	attrs := []any{"recipient", recipient, "template", templateFile}
+
+	if m.debug {
+		attrs = append(attrs, "data", data)
+	}
+
+	m.logger.Warn("smtp isn't configured, email not sent", attrs...)
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	tests := []struct {
+		name      string
+		debug     bool
+		wantToken bool
+	}{
+		{"development", true, true},
+		{"production", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			m := logMailer{logger: slog.New(slog.NewTextHandler(&buf, nil)), debug: tt.debug}
+
+			err := m.Send("alice@example.org", "email_change.tmpl", map[string]any{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"})
+			if err != nil {
+				t.Fatalf("got error %v; want nil", err)
+			}
+
+			out := buf.String()
+
+			if !strings.Contains(out, "recipient=alice@example.org") || !strings.Contains(out, "template=email_change.tmpl") {
+				t.Errorf("got log %q; want the recipient and template", out)
+			}
+
+			if got := strings.Contains(out, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"); got != tt.wantToken {
+				t.Errorf("got token logged %t; want %t", got, tt.wantToken)
+			}
+		})
+	}
+}
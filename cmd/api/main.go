@@ -2,10 +2,18 @@ package main
 
 import (
 	"GoTodo/internal/data"
+	"GoTodo/internal/mailer"
 	"context"
+	"expvar"
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/mail"
+	"net/netip"
 	"os"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -14,21 +22,106 @@ import (
 
 const version = "1.0.0"
 
+// schemaVersion is the latest migration in ./migrations this build expects to
+// run against. Bump it together with new migrations.
+const schemaVersion = 24
+
+const (
+	authModeStateful = "stateful"
+	authModeJWT      = "jwt"
+)
+
 type config struct {
-	port int
-	env  string
-	db   struct {
-		dsn             string
-		maxOpenConns    int
-		minConns        int
-		maxConnIdleTime time.Duration
+	port           int
+	env            string
+	debug          bool
+	trustedProxies []netip.Prefix
+	server         struct {
+		readTimeout       time.Duration
+		readHeaderTimeout time.Duration
+		writeTimeout      time.Duration
+		idleTimeout       time.Duration
+		requestTimeout    time.Duration
+		shutdownTimeout   time.Duration
+	}
+	db struct {
+		dsn                  string
+		maxOpenConns         int
+		minConns             int
+		maxConnIdleTime      time.Duration
+		queryTimeout         time.Duration
+		bulkQueryTimeout     time.Duration
+		readAttempts         int
+		readRetryDelay       time.Duration
+		statsInterval        time.Duration
+		connectAttempts      int
+		connectRetryInterval time.Duration
+		slowQueryThreshold   time.Duration
+	}
+	metrics struct {
+		enabled bool
+	}
+	secureHeaders struct {
+		enabled               bool
+		contentSecurityPolicy string
+	}
+	log struct {
+		format string
+		level  string
+	}
+	limiter struct {
+		rps     float64
+		burst   int
+		enabled bool
+	}
+	bcryptCost          int
+	maxBodyBytes        int64
+	requireContentType  bool
+	strictEmails        bool
+	registrationEnabled bool
+	auth                struct {
+		mode            string
+		jwtSecret       string
+		tokenTTL        time.Duration
+		refreshTokenTTL time.Duration
+		cacheSize       int
+		cacheTTL        time.Duration
+	}
+	login struct {
+		maxAttempts int
+		window      time.Duration
+		lockout     time.Duration
+	}
+	todos struct {
+		requireSubtasksComplete bool
+		maxTitleLength          int
+		maxDescriptionLength    int
+		requireDueDate          bool
+		maxPerUser              int
+	}
+	pagination struct {
+		defaultPageSize int
+		maxPageSize     int
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
 	}
 }
 
 type application struct {
-	config config
-	models data.Models
-	logger *slog.Logger
+	config       config
+	db           *pgxpool.Pool
+	models       data.Models
+	logger       *slog.Logger
+	loginLimiter *loginLimiter
+	rateLimiter  *ipLimiter
+	events       *todoBroker
+	mailer       emailSender
+	wg           sync.WaitGroup
 }
 
 func main() {
@@ -39,25 +132,207 @@ func main() {
 		os.Exit(1)
 	}
 
-	dsn := os.Getenv("DB_DSN")
-
-	if dsn == "" {
-		logger.Error("required DB_DSN env var missing")
-		os.Exit(1)
-	}
-
 	var cfg config
+	var configFile string
 
-	flag.StringVar(&cfg.db.dsn, "db-dsn", dsn, "PostgreSQL DSN")
+	flag.StringVar(&configFile, "config", "", "Path to a JSON config file keyed by flag name; command-line flags override its values")
+	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DB_DSN"), "PostgreSQL DSN")
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.BoolVar(&cfg.debug, "debug", false, "Include the error and stack trace in 500 responses; not allowed in production")
+	flag.Func("trusted-proxy-cidrs", "Comma-separated CIDRs of reverse proxies whose X-Forwarded-* headers are trusted", func(value string) error {
+		var err error
+		cfg.trustedProxies, err = parseCIDRs(value)
+		return err
+	})
+	flag.DurationVar(&cfg.server.readTimeout, "server-read-timeout", 5*time.Second, "Maximum duration for reading an entire request")
+	flag.DurationVar(&cfg.server.readHeaderTimeout, "server-read-header-timeout", 2*time.Second, "Maximum duration for reading request headers")
+	flag.DurationVar(&cfg.server.writeTimeout, "server-write-timeout", 45*time.Second, "Maximum duration before timing out writes of the response; must be longer than request-timeout and db-bulk-query-timeout")
+	flag.DurationVar(&cfg.server.idleTimeout, "server-idle-timeout", time.Minute, "Maximum time to wait for the next request on keep-alive connections")
+	flag.DurationVar(&cfg.server.requestTimeout, "request-timeout", 30*time.Second, "Maximum duration a handler may take before the request fails with 503")
+	flag.DurationVar(&cfg.server.shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time given to in-flight requests to finish once a shutdown signal is received")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.minConns, "db-min-conns", 6, "PostgreSQL min connections")
 	flag.DurationVar(&cfg.db.maxConnIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
+	flag.DurationVar(&cfg.db.queryTimeout, "db-query-timeout", 3*time.Second, "PostgreSQL per-query timeout")
+	flag.DurationVar(&cfg.db.bulkQueryTimeout, "db-bulk-query-timeout", 30*time.Second, "PostgreSQL timeout for todo imports and exports")
+	flag.IntVar(&cfg.db.readAttempts, "db-read-attempts", 3, "Attempts made for read queries failing with transient connection errors")
+	flag.DurationVar(&cfg.db.readRetryDelay, "db-read-retry-delay", 50*time.Millisecond, "Initial backoff between read query attempts, doubled after each retry")
+	flag.IntVar(&cfg.db.connectAttempts, "db-connect-attempts", 5, "Attempts made to reach the database on startup before giving up")
+	flag.DurationVar(&cfg.db.connectRetryInterval, "db-connect-retry-interval", time.Second, "Initial wait between startup connection attempts, doubled after each retry")
+	flag.DurationVar(&cfg.db.slowQueryThreshold, "slow-query-threshold", 200*time.Millisecond, "Log queries that take longer than this at warn level (0 disables)")
+	flag.DurationVar(&cfg.db.statsInterval, "db-stats-interval", time.Minute, "How often to log connection pool stats (0 disables)")
+	flag.BoolVar(&cfg.secureHeaders.enabled, "secure-headers", true, "Set browser security headers such as X-Content-Type-Options and X-Frame-Options on responses")
+	flag.StringVar(&cfg.secureHeaders.contentSecurityPolicy, "content-security-policy", "default-src 'none'; frame-ancestors 'none'", "Content-Security-Policy header value when secure-headers is on (empty omits the header)")
+	flag.BoolVar(&cfg.metrics.enabled, "metrics-enabled", false, "Expose metrics endpoint in production")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Int64Var(&cfg.maxBodyBytes, "max-body-bytes", 1_048_576, "Maximum request body size in bytes")
+	flag.BoolVar(&cfg.requireContentType, "require-content-type", false, "Reject request bodies sent without a Content-Type header instead of treating them as JSON")
+	flag.BoolVar(&cfg.registrationEnabled, "registration-enabled", true, "Allow new users to sign up")
+	flag.StringVar(&cfg.auth.mode, "auth-mode", authModeStateful, "Authentication token type (stateful|jwt); JWTs aren't stored, so they can't be revoked before they expire")
+	flag.StringVar(&cfg.auth.jwtSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "Secret used to sign JWTs in jwt auth mode")
+	flag.DurationVar(&cfg.auth.tokenTTL, "auth-token-ttl", 15*time.Minute, "Authentication token lifetime; short since clients renew it with their refresh token")
+	flag.DurationVar(&cfg.auth.refreshTokenTTL, "refresh-token-ttl", 7*24*time.Hour, "Refresh token lifetime")
+	flag.IntVar(&cfg.auth.cacheSize, "token-cache-size", 0, "Number of authenticated tokens to cache in memory (0 disables the cache)")
+	flag.DurationVar(&cfg.auth.cacheTTL, "token-cache-ttl", 30*time.Second, "How long an authenticated token may be served from the cache")
+	flag.IntVar(&cfg.login.maxAttempts, "login-max-attempts", 5, "Failed sign-in attempts allowed before locking an account")
+	flag.DurationVar(&cfg.login.window, "login-attempt-window", 15*time.Minute, "Window in which failed sign-in attempts are counted")
+	flag.DurationVar(&cfg.login.lockout, "login-lockout", 15*time.Minute, "How long an account stays locked after too many failed sign-in attempts")
+	flag.BoolVar(&cfg.todos.requireSubtasksComplete, "require-subtasks-complete", false, "Only allow completing a todo once all of its subtasks are completed")
+	defaultTodoOptions := data.DefaultValidateTodoOptions()
+	flag.IntVar(&cfg.todos.maxTitleLength, "todo-max-title-length", defaultTodoOptions.MaxTitleLength, "Longest todo title allowed, in characters")
+	flag.IntVar(&cfg.todos.maxDescriptionLength, "todo-max-description-length", defaultTodoOptions.MaxDescriptionLength, "Longest todo description allowed, in characters")
+	flag.BoolVar(&cfg.todos.requireDueDate, "todo-require-due-date", defaultTodoOptions.RequireDueDate, "Reject todos without a due date")
+	flag.IntVar(&cfg.todos.maxPerUser, "max-todos-per-user", 0, "Most active (not completed) todos a user may have (0 means unlimited)")
+	flag.IntVar(&cfg.pagination.defaultPageSize, "default-page-size", 10, "Page size used when a list request doesn't specify one")
+	flag.IntVar(&cfg.pagination.maxPageSize, "max-page-size", data.DefaultMaxPageSize, "Largest page size a list request may ask for")
+	flag.IntVar(&cfg.bcryptCost, "bcrypt-cost", 12, "Bcrypt cost used to hash passwords")
+	flag.BoolVar(&cfg.strictEmails, "strict-email-validation", false, "Also validate email addresses with net/mail on top of the regex check")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP server host; emails are only logged when it's empty")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP server port")
+	flag.StringVar(&cfg.smtp.username, "smtp-user", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-pass", os.Getenv("SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "GoTodo <no-reply@gotodo.local>", "Sender address for outgoing emails")
+	flag.StringVar(&cfg.log.format, "log-format", "text", "Log format (text|json)")
+	flag.StringVar(&cfg.log.level, "log-level", "info", "Minimum log level (debug|info|warn|error)")
 
 	flag.Parse()
 
-	db, err := openDB(cfg)
+	if configFile != "" {
+		err = loadConfigFile(flag.CommandLine, configFile)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	logger, err = newLogger(os.Stdout, cfg.log.format, cfg.log.level)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if cfg.db.dsn == "" {
+		logger.Error("a PostgreSQL DSN is required, set DB_DSN or db-dsn")
+		os.Exit(1)
+	}
+
+	if cfg.debug && cfg.env == "production" {
+		logger.Error("debug must not be enabled in production")
+		os.Exit(1)
+	}
+
+	if cfg.maxBodyBytes <= 0 {
+		logger.Error("max-body-bytes must be greater than 0")
+		os.Exit(1)
+	}
+
+	if cfg.server.shutdownTimeout <= 0 {
+		logger.Error("shutdown-timeout must be a positive duration")
+		os.Exit(1)
+	}
+
+	if cfg.server.requestTimeout <= 0 {
+		logger.Error("request-timeout must be a positive duration")
+		os.Exit(1)
+	}
+
+	// A write timeout shorter than the request timeout would drop the
+	// connection before a slow handler's 503 could be sent. Exports aren't
+	// bound by the request timeout, so they need it to outlast theirs too.
+	if cfg.server.writeTimeout <= max(cfg.server.requestTimeout, cfg.db.bulkQueryTimeout) {
+		logger.Error("server-write-timeout must be longer than request-timeout and db-bulk-query-timeout")
+		os.Exit(1)
+	}
+
+	if cfg.auth.tokenTTL <= 0 || cfg.auth.refreshTokenTTL <= 0 {
+		logger.Error("auth-token-ttl and refresh-token-ttl must be positive durations")
+		os.Exit(1)
+	}
+
+	switch cfg.auth.mode {
+	case authModeStateful:
+	case authModeJWT:
+		if len(cfg.auth.jwtSecret) < 32 {
+			logger.Error("jwt-secret must be at least 32 bytes long in jwt auth mode")
+			os.Exit(1)
+		}
+	default:
+		logger.Error(fmt.Sprintf("invalid auth mode %q, use one of the following: stateful, jwt", cfg.auth.mode))
+		os.Exit(1)
+	}
+
+	if cfg.pagination.maxPageSize <= 0 || cfg.pagination.defaultPageSize <= 0 || cfg.pagination.defaultPageSize > cfg.pagination.maxPageSize {
+		logger.Error("default-page-size must be positive and not greater than max-page-size")
+		os.Exit(1)
+	}
+
+	if cfg.todos.maxTitleLength <= 0 || cfg.todos.maxDescriptionLength <= 0 {
+		logger.Error("todo-max-title-length and todo-max-description-length must be greater than 0")
+		os.Exit(1)
+	}
+
+	if cfg.todos.maxPerUser < 0 {
+		logger.Error("max-todos-per-user must not be negative")
+		os.Exit(1)
+	}
+
+	if cfg.login.maxAttempts <= 0 {
+		logger.Error("login-max-attempts must be greater than 0")
+		os.Exit(1)
+	}
+
+	err = data.SetBcryptCost(cfg.bcryptCost)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	data.SetStrictEmailValidation(cfg.strictEmails)
+
+	err = data.SetQueryTimeout(cfg.db.queryTimeout)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	err = data.SetBulkQueryTimeout(cfg.db.bulkQueryTimeout)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	err = data.SetReadRetries(cfg.db.readAttempts, cfg.db.readRetryDelay)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	err = data.SetTokenCache(cfg.auth.cacheSize, cfg.auth.cacheTTL)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if cfg.db.connectAttempts <= 0 {
+		logger.Error("db-connect-attempts must be greater than 0")
+		os.Exit(1)
+	}
+
+	_, err = mail.ParseAddress(cfg.smtp.sender)
+	if err != nil {
+		logger.Error("smtp-sender must be a valid email address")
+		os.Exit(1)
+	}
+
+	if cfg.db.slowQueryThreshold < 0 {
+		logger.Error("slow-query-threshold must not be negative")
+		os.Exit(1)
+	}
+
+	db, err := openDB(cfg, logger)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
@@ -66,10 +341,53 @@ func main() {
 	defer db.Close()
 	logger.Info("connection pool stablished")
 
+	expvar.NewString("version").Set(version)
+
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+
+	expvar.Publish("database", expvar.Func(func() any {
+		stats := db.Stat()
+
+		return map[string]any{
+			"total_conns":                stats.TotalConns(),
+			"idle_conns":                 stats.IdleConns(),
+			"acquired_conns":             stats.AcquiredConns(),
+			"constructing_conns":         stats.ConstructingConns(),
+			"max_conns":                  stats.MaxConns(),
+			"acquire_count":              stats.AcquireCount(),
+			"acquire_duration":           stats.AcquireDuration().String(),
+			"empty_acquire_count":        stats.EmptyAcquireCount(),
+			"canceled_acquire_count":     stats.CanceledAcquireCount(),
+			"new_conns_count":            stats.NewConnsCount(),
+			"max_idle_destroy_count":     stats.MaxIdleDestroyCount(),
+			"max_lifetime_destroy_count": stats.MaxLifetimeDestroyCount(),
+		}
+	}))
+
+	expvar.Publish("timestamp", expvar.Func(func() any {
+		return time.Now().Unix()
+	}))
+
 	app := &application{
-		config: cfg,
-		models: data.NewModels(db),
-		logger: logger,
+		config:       cfg,
+		db:           db,
+		models:       data.NewModels(db),
+		logger:       logger,
+		loginLimiter: newLoginLimiter(cfg.login.maxAttempts, cfg.login.window, cfg.login.lockout),
+		rateLimiter:  newIPLimiter(cfg.limiter.rps, cfg.limiter.burst),
+		events:       newTodoBroker(),
+	}
+
+	if cfg.smtp.host != "" {
+		app.mailer = mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+	} else {
+		app.mailer = logMailer{logger: logger, debug: cfg.env == "development"}
+	}
+
+	if cfg.db.statsInterval > 0 {
+		go app.samplePoolStats(db, cfg.db.statsInterval)
 	}
 
 	err = app.serve()
@@ -79,10 +397,27 @@ func main() {
 	}
 }
 
-func openDB(cfg config) (*pgxpool.Pool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func newLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+
+	err := logLevel.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q, use one of the following: debug, info, warn, error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
 
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, use one of the following: text, json", format)
+	}
+}
+
+func openDB(cfg config, logger *slog.Logger) (*pgxpool.Pool, error) {
 	poolConfig, err := pgxpool.ParseConfig(cfg.db.dsn)
 	if err != nil {
 		return nil, err
@@ -92,12 +427,16 @@ func openDB(cfg config) (*pgxpool.Pool, error) {
 	poolConfig.MinConns = int32(cfg.db.minConns) // use ~25% of MaxConns
 	poolConfig.MaxConnIdleTime = cfg.db.maxConnIdleTime
 
-	connectionPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if cfg.db.slowQueryThreshold > 0 {
+		poolConfig.ConnConfig.Tracer = &slowQueryTracer{logger: logger, threshold: cfg.db.slowQueryThreshold}
+	}
+
+	connectionPool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	err = connectionPool.Ping(ctx)
+	err = waitForDB(func() error { return pingDB(connectionPool) }, cfg.db.connectAttempts, cfg.db.connectRetryInterval, logger)
 	if err != nil {
 		connectionPool.Close()
 		return nil, err
@@ -105,3 +444,33 @@ func openDB(cfg config) (*pgxpool.Pool, error) {
 
 	return connectionPool, nil
 }
+
+// waitForDB calls ping until it succeeds, up to attempts times. The database
+// may still be starting up, e.g. when both come up together in containers, so
+// failures are retried with a backoff that doubles from interval.
+func waitForDB(ping func() error, attempts int, interval time.Duration, logger *slog.Logger) error {
+	delay := interval
+
+	for attempt := 1; ; attempt++ {
+		err := ping()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= attempts {
+			return fmt.Errorf("database unavailable after %d attempts: %w", attempt, err)
+		}
+
+		logger.Warn("database not ready, retrying", "attempt", attempt, "retry_in", delay.String(), "error", err.Error())
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func pingDB(pool *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return pool.Ping(ctx)
+}
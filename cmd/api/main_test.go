@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := newLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("got error %v; want nil", err)
+	}
+
+	logger.Debug("debug message")
+	logger.Info("info message")
+	logger.Warn("warn message", "key", "value")
+	logger.Error("error message")
+
+	var lines []map[string]any
+
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("got unparseable log line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines; want 2", len(lines))
+	}
+
+	want := []struct{ level, msg string }{
+		{"WARN", "warn message"},
+		{"ERROR", "error message"},
+	}
+
+	for i, w := range want {
+		if lines[i]["level"] != w.level {
+			t.Errorf("line %d: got level %v; want %s", i, lines[i]["level"], w.level)
+		}
+		if lines[i]["msg"] != w.msg {
+			t.Errorf("line %d: got msg %v; want %s", i, lines[i]["msg"], w.msg)
+		}
+	}
+
+	if lines[0]["key"] != "value" {
+		t.Errorf("got key %v; want value", lines[0]["key"])
+	}
+}
+
+func TestNewLoggerInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		level  string
+	}{
+		{"format", "xml", "info"},
+		{"level", "json", "verbose"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newLogger(&bytes.Buffer{}, tt.format, tt.level)
+			if err == nil {
+				t.Errorf("got nil error; want an error")
+			}
+		})
+	}
+}
+
+func TestWaitForDB(t *testing.T) {
+	errNotReady := errors.New("connection refused")
+
+	tests := []struct {
+		name         string
+		failures     int
+		attempts     int
+		wantErr      bool
+		wantPings    int
+		wantRetries  int
+		wantMinDelay time.Duration
+	}{
+		{"available", 0, 5, false, 1, 0, 0},
+		{"available after two attempts", 2, 5, false, 3, 2, 3 * time.Millisecond},
+		{"never available", 10, 3, true, 3, 2, 3 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+			pings := 0
+			ping := func() error {
+				pings++
+				if pings <= tt.failures {
+					return errNotReady
+				}
+				return nil
+			}
+
+			start := time.Now()
+
+			err := waitForDB(ping, tt.attempts, time.Millisecond, logger)
+
+			if tt.wantErr {
+				if !errors.Is(err, errNotReady) {
+					t.Errorf("got error %v; want %v", err, errNotReady)
+				}
+			} else if err != nil {
+				t.Errorf("got error %v; want nil", err)
+			}
+
+			if pings != tt.wantPings {
+				t.Errorf("got %d pings; want %d", pings, tt.wantPings)
+			}
+
+			if retries := strings.Count(buf.String(), "database not ready, retrying"); retries != tt.wantRetries {
+				t.Errorf("got %d retries logged; want %d", retries, tt.wantRetries)
+			}
+
+			// The delay doubles after each retry: 1ms, then 2ms.
+			if elapsed := time.Since(start); elapsed < tt.wantMinDelay {
+				t.Errorf("got %s between attempts; want at least %s", elapsed, tt.wantMinDelay)
+			}
+		})
+	}
+}
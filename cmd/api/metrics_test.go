@@ -0,0 +1,57 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+
+	handler := app.metrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	received := totalRequestsReceived.Value()
+	sent := totalResponsesSent.Value()
+	ok := statusCount(t, "200")
+	notFound := statusCount(t, "404")
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := totalRequestsReceived.Value() - received; got != 3 {
+		t.Errorf("total_requests_received went up by %d; want 3", got)
+	}
+
+	if got := totalResponsesSent.Value() - sent; got != 3 {
+		t.Errorf("total_responses_sent went up by %d; want 3", got)
+	}
+
+	if got := statusCount(t, "200") - ok; got != 2 {
+		t.Errorf("200 responses went up by %d; want 2", got)
+	}
+
+	if got := statusCount(t, "404") - notFound; got != 1 {
+		t.Errorf("404 responses went up by %d; want 1", got)
+	}
+
+	// Building the middleware again must reuse the published counters.
+	app.metrics(handler)
+}
+
+func statusCount(t *testing.T, status string) int64 {
+	t.Helper()
+
+	counter := totalResponsesSentByStatus.Get(status)
+	if counter == nil {
+		return 0
+	}
+
+	return counter.(*expvar.Int).Value()
+}
@@ -3,38 +3,39 @@ package main
 import (
 	"GoTodo/internal/data"
 	"GoTodo/internal/data/validator"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 )
 
 func (app *application) protectedRouteMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
-		authorizationHeader := r.Header.Get("Authorization")
-
-		if authorizationHeader == "" {
+		token, ok := app.readBearerToken(r)
+		if !ok {
 			app.invalidAuthenticationHeaderResponse(w, r)
 			return
 		}
 
-		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			app.invalidAuthenticationHeaderResponse(w, r)
-			return
-		}
+		var user *data.User
+		var err error
 
-		token := headerParts[1]
+		if app.config.auth.mode == authModeJWT {
+			user, err = app.userForJWT(r.Context(), token)
+		} else {
+			v := validator.New()
 
-		v := validator.New()
+			if data.ValidateTokenPlainText(v, token); !v.Valid() {
+				app.invalidAuthenticationHeaderResponse(w, r)
+				return
+			}
 
-		if data.ValidateTokenPlainText(v, token); !v.Valid() {
-			app.invalidAuthenticationHeaderResponse(w, r)
-			return
+			user, err = app.models.Tokens.GetForToken(r.Context(), data.ScopeAuthentication, token)
 		}
-
-		user, err := app.models.Tokens.GetForToken(token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -50,3 +51,183 @@ func (app *application) protectedRouteMiddleware(next http.HandlerFunc) http.Han
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+
+		if requestID == "" || len(requestID) > 200 {
+			var err error
+
+			requestID, err = newRequestID()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+
+		r = app.contextSetRequestID(r, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// secureHeaders sets the headers that keep browsers from sniffing content
+// types, framing responses or leaking the URL in the Referer header. Clients
+// that aren't browsers have no use for them, so they can be turned off.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.secureHeaders.enabled {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("X-Frame-Options", "deny")
+			w.Header().Set("Referrer-Policy", "no-referrer")
+
+			if app.config.secureHeaders.contentSecurityPolicy != "" {
+				w.Header().Set("Content-Security-Policy", app.config.secureHeaders.contentSecurityPolicy)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			ip        = app.realIP(r)
+			proto     = r.Proto
+			method    = r.Method
+			uri       = r.URL.RequestURI()
+			requestID = app.contextGetRequestID(r)
+		)
+
+		app.logger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri, "request_id", requestID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// streamingPaths are served without requestTimeout. http.TimeoutHandler
+// buffers the whole response, which would hold back streamed exports until
+// they finish and never let an event stream through.
+var streamingPaths = map[string]bool{
+	"/v1/todos/stream":       true,
+	"/v1/todos/export":       true,
+	"/v1/todos/calendar.ics": true,
+}
+
+// requestTimeout cuts off requests that take longer than the configured
+// timeout with a 503. The request context carries the deadline and the models
+// derive their query contexts from it, so queries still running when the
+// timeout fires are cancelled too. The response is buffered until the handler
+// returns, so streaming endpoints bypass it.
+func (app *application) requestTimeout(next http.Handler) http.Handler {
+	message, _ := json.Marshal(envelope{"error": "the server took too long to process your request"})
+	handler := http.TimeoutHandler(next, app.config.server.requestTimeout, string(message))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if streamingPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only the timeout response relies on this; headers set by next
+		// replace it when the handler finishes in time.
+		w.Header().Set("Content-Type", "application/json")
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// requireRole must wrap handlers that are already behind
+// protectedRouteMiddleware, as it relies on the user in the request context.
+func (app *application) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.Role != role {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type metricsResponseWriter struct {
+	wrapped       http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+}
+
+func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
+	return &metricsResponseWriter{
+		wrapped:    w,
+		statusCode: http.StatusOK,
+	}
+}
+
+func (mw *metricsResponseWriter) Header() http.Header {
+	return mw.wrapped.Header()
+}
+
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	mw.wrapped.WriteHeader(statusCode)
+
+	if !mw.headerWritten {
+		mw.statusCode = statusCode
+		mw.headerWritten = true
+	}
+}
+
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	mw.headerWritten = true
+	return mw.wrapped.Write(b)
+}
+
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.wrapped
+}
+
+// The request counters are registered once, since expvar panics when a name
+// is published twice, and shared by every handler built by routes.
+var (
+	totalRequestsReceived           = expvar.NewInt("total_requests_received")
+	totalResponsesSent              = expvar.NewInt("total_responses_sent")
+	totalProcessingTimeMicroseconds = expvar.NewInt("total_processing_time_μs")
+	totalResponsesSentByStatus      = expvar.NewMap("total_responses_sent_by_status")
+)
+
+func (app *application) metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		totalRequestsReceived.Add(1)
+
+		mw := newMetricsResponseWriter(w)
+		next.ServeHTTP(mw, r)
+
+		totalResponsesSent.Add(1)
+		totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
+
+		duration := time.Since(start).Microseconds()
+		totalProcessingTimeMicroseconds.Add(duration)
+	})
+}
+
+func (app *application) rateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.limiter.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !app.rateLimiter.allow(app.realIP(r)) {
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.server.requestTimeout = 50 * time.Millisecond
+
+	cancelled := make(chan struct{})
+
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(time.Second):
+		}
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/todos", nil)
+
+	app.requestTimeout(slow).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want %q", got, "application/json")
+	}
+
+	var body map[string]string
+
+	err := json.Unmarshal(rr.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+
+	if body["error"] == "" {
+		t.Errorf("response has no error message: %s", rr.Body)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the handler's context wasn't cancelled")
+	}
+}
+
+func TestRequestTimeoutFastHandler(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.server.requestTimeout = time.Second
+
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("ok"))
+	})
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/todos", nil)
+
+	app.requestTimeout(fast).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusTeapot)
+	}
+
+	if got := rr.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("got Content-Type %q; want %q", got, "text/plain")
+	}
+
+	if got := rr.Body.String(); got != "ok" {
+		t.Errorf("got body %q; want %q", got, "ok")
+	}
+}
+
+func TestRequestTimeoutStreamingPaths(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.server.requestTimeout = time.Second
+
+	tests := []struct {
+		path      string
+		canFlush  bool
+		hasCutoff bool
+	}{
+		{path: "/v1/todos/export", canFlush: true},
+		{path: "/v1/todos/calendar.ics", canFlush: true},
+		{path: "/v1/todos/stream", canFlush: true},
+		{path: "/v1/todos", canFlush: false, hasCutoff: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var flushErr error
+			var hasDeadline bool
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, hasDeadline = r.Context().Deadline()
+				flushErr = http.NewResponseController(w).Flush()
+			})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			app.requestTimeout(next).ServeHTTP(rr, r)
+
+			if tt.canFlush && flushErr != nil {
+				t.Errorf("got flush error %v; want the response to be streamed", flushErr)
+			}
+
+			if !tt.canFlush && !errors.Is(flushErr, http.ErrNotSupported) {
+				t.Errorf("got flush error %v; want %v", flushErr, http.ErrNotSupported)
+			}
+
+			if hasDeadline != tt.hasCutoff {
+				t.Errorf("got request deadline %t; want %t", hasDeadline, tt.hasCutoff)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"supplied", "abc-123"},
+		{"missing", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			var got string
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = app.contextGetRequestID(r)
+			})
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+
+			app.requestID(next).ServeHTTP(rr, r)
+
+			if tt.header != "" && got != tt.header {
+				t.Errorf("got request ID %q; want %q", got, tt.header)
+			}
+
+			if got == "" {
+				t.Error("got no request ID")
+			}
+
+			if echoed := rr.Header().Get("X-Request-ID"); echoed != got {
+				t.Errorf("got X-Request-ID %q; want %q", echoed, got)
+			}
+		})
+	}
+}
+
+func TestProtectedRouteJWT(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.auth.mode = authModeJWT
+	app.config.auth.jwtSecret = "0123456789abcdef0123456789abcdef"
+
+	valid, err := app.newJWT(1, "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.config.auth.tokenTTL = -time.Minute
+
+	expired, err := app.newJWT(1, "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(valid.Plaintext, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", expired.Plaintext},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))},
+		{"stateful token", "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+
+			next := func(w http.ResponseWriter, r *http.Request) { called = true }
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/todos", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+
+			app.protectedRouteMiddleware(next)(rr, r)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("got status %d; want %d", rr.Code, http.StatusUnauthorized)
+			}
+
+			if called {
+				t.Error("the protected handler was called")
+			}
+		})
+	}
+}
+
+func TestProtectedRouteJWTValid(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.auth.mode = authModeJWT
+	app.config.auth.jwtSecret = "0123456789abcdef0123456789abcdef"
+
+	user := insertTestUser(t, app, "alice@example.com")
+
+	pair := signIn(t, app, "alice@example.com")
+
+	if strings.Count(pair.AuthenticationToken.Token, ".") != 2 {
+		t.Fatalf("got authentication token %q; want a JWT", pair.AuthenticationToken.Token)
+	}
+
+	var got *data.User
+
+	next := func(w http.ResponseWriter, r *http.Request) { got = app.contextGetUser(r) }
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/todos", nil)
+	r.Header.Set("Authorization", "Bearer "+pair.AuthenticationToken.Token)
+
+	app.protectedRouteMiddleware(next)(rr, r)
+
+	if got == nil || got.Id != user.Id {
+		t.Errorf("got user %+v; want %+v", got, user)
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		csp     string
+		want    map[string]string
+	}{
+		{
+			"enabled",
+			true,
+			"default-src 'none'",
+			map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "deny",
+				"Referrer-Policy":         "no-referrer",
+				"Content-Security-Policy": "default-src 'none'",
+			},
+		},
+		{
+			"enabled without a content security policy",
+			true,
+			"",
+			map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"X-Frame-Options":         "deny",
+				"Referrer-Policy":         "no-referrer",
+				"Content-Security-Policy": "",
+			},
+		},
+		{
+			"disabled",
+			false,
+			"default-src 'none'",
+			map[string]string{
+				"X-Content-Type-Options":  "",
+				"X-Frame-Options":         "",
+				"Referrer-Policy":         "",
+				"Content-Security-Policy": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.secureHeaders.enabled = tt.enabled
+			app.config.secureHeaders.contentSecurityPolicy = tt.csp
+
+			rr := httptest.NewRecorder()
+			app.routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/version", nil))
+
+			for header, want := range tt.want {
+				if got := rr.Header().Get(header); got != want {
+					t.Errorf("%s: got %q; want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
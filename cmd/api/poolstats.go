@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// poolSaturationRatio is the share of the pool's connections that may be
+// acquired before the sampler starts warning about saturation.
+const poolSaturationRatio = 0.8
+
+// samplePoolStats logs the connection pool's stats every interval, warning
+// when the acquired connections approach the pool's maximum. It's meant to be
+// run in its own goroutine.
+func (app *application) samplePoolStats(pool *pgxpool.Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		app.logPoolStats(pool.Stat())
+	}
+}
+
+func (app *application) logPoolStats(stats *pgxpool.Stat) {
+	attrs := []any{
+		"acquired", stats.AcquiredConns(),
+		"idle", stats.IdleConns(),
+		"total", stats.TotalConns(),
+		"max", stats.MaxConns(),
+	}
+
+	if float64(stats.AcquiredConns()) >= poolSaturationRatio*float64(stats.MaxConns()) {
+		app.logger.Warn("database pool close to saturation", attrs...)
+		return
+	}
+
+	app.logger.Debug("database pool stats", attrs...)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lineWriter sends every log line written to it on a channel.
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestSamplePoolStats(t *testing.T) {
+	lines := make(lineWriter, 16)
+
+	app := newTestApplication(t)
+	app.logger = slog.New(slog.NewTextHandler(lines, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	const interval = 20 * time.Millisecond
+
+	start := time.Now()
+
+	go app.samplePoolStats(newClosedPool(t), interval)
+
+	for i := 1; i <= 3; i++ {
+		var line string
+
+		select {
+		case line = <-lines:
+		case <-time.After(time.Second):
+			t.Fatalf("got %d log lines; want 3", i-1)
+		}
+
+		if elapsed := time.Since(start); elapsed < time.Duration(i)*interval {
+			t.Errorf("line %d logged after %s; want at least %s", i, elapsed, time.Duration(i)*interval)
+		}
+
+		if !strings.Contains(line, "database pool stats") {
+			t.Errorf("got line %q; want the pool stats", line)
+		}
+
+		for _, key := range []string{"acquired=0", "idle=0", "total=0", "max="} {
+			if !strings.Contains(line, key) {
+				t.Errorf("got line %q; want it to contain %s", line, key)
+			}
+		}
+	}
+}
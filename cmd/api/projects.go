@@ -0,0 +1,212 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/data/validator"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+func (app *application) createProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	project := &data.Project{
+		Name: input.Name,
+	}
+
+	v := validator.New()
+
+	if data.ValidateProject(v, project); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Projects.Insert(r.Context(), user.Id, project)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateProjectName):
+			v.AddError("name", "a project with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", app.absoluteURL(r, fmt.Sprintf("/v1/projects/%d", project.ID)))
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"project": project}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	projects, err := app.models.Projects.GetAll(r.Context(), user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"projects": projects}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showProjectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "project")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	project, err := app.models.Projects.Get(r.Context(), id, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "project")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"project": project}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "project")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	project, err := app.models.Projects.Get(r.Context(), id, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "project")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		project.Name = *input.Name
+	}
+
+	v := validator.New()
+
+	if data.ValidateProject(v, project); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Projects.Update(r.Context(), user.Id, project)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateProjectName):
+			v.AddError("name", "a project with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"project": project}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "project")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Projects.Delete(r.Context(), id, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "project")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "project deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkProject records a validation error unless projectId is nil or refers to
+// one of the user's projects.
+func (app *application) checkProject(ctx context.Context, v *validator.Validator, userId int64, projectId *int64) error {
+	if projectId == nil {
+		return nil
+	}
+
+	_, err := app.models.Projects.Get(ctx, *projectId, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("project_id", "must refer to one of your projects")
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestProjects(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	var created struct {
+		Project struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"project"`
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/projects", alice, map[string]string{"name": "Home"}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("creating a project: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	projectID := created.Project.ID
+
+	var assigned todoResponse
+
+	status = do(t, app, http.MethodPost, "/v1/todos", alice, map[string]any{"title": "Fix the sink", "project_id": projectID}, &assigned)
+	if status != http.StatusCreated {
+		t.Fatalf("assigning a todo: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if status, _ := createTodo(t, app, alice, "Call the bank"); status != http.StatusCreated {
+		t.Fatalf("creating an unassigned todo: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	query := fmt.Sprintf("project_id=%d", projectID)
+
+	if got, want := listTodos(t, app, alice, query).titles(), []string{"Fix the sink"}; !slices.Equal(got, want) {
+		t.Errorf("filtering by project: got %v; want %v", got, want)
+	}
+
+	status = do(t, app, http.MethodPost, "/v1/todos", bob, map[string]any{"title": "Intrude", "project_id": projectID}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("assigning to another user's project: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	path := fmt.Sprintf("/v1/projects/%d", projectID)
+
+	if status := do(t, app, http.MethodDelete, path, bob, nil, nil); status != http.StatusNotFound {
+		t.Errorf("deleting another user's project: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	if status := do(t, app, http.MethodDelete, path, alice, nil, nil); status != http.StatusOK {
+		t.Fatalf("deleting the project: got status %d; want %d", status, http.StatusOK)
+	}
+
+	// The project's todos are kept, without a project.
+	var todo struct {
+		Todo struct {
+			Title     string `json:"title"`
+			ProjectID *int64 `json:"project_id"`
+		} `json:"todo"`
+	}
+
+	status = do(t, app, http.MethodGet, fmt.Sprintf("/v1/todos/%d", assigned.Todo.ID), alice, nil, &todo)
+	if status != http.StatusOK {
+		t.Fatalf("fetching the todo: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if todo.Todo.ProjectID != nil {
+		t.Errorf("got project_id %d; want null", *todo.Todo.ProjectID)
+	}
+}
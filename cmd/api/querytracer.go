@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+// slowQueryTracer logs queries that take longer than threshold. Query
+// arguments are left out of the log as they may hold passwords or tokens.
+type slowQueryTracer struct {
+	logger    *slog.Logger
+	threshold time.Duration
+}
+
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartContextKey, queryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	query, ok := ctx.Value(queryStartContextKey).(queryStart)
+	if !ok {
+		return
+	}
+
+	duration := time.Since(query.start)
+	if duration < t.threshold {
+		return
+	}
+
+	attrs := []any{
+		"sql", strings.Join(strings.Fields(query.sql), " "),
+		"duration", duration.String(),
+	}
+
+	if data.Err != nil {
+		attrs = append(attrs, "error", data.Err.Error())
+	}
+
+	t.logger.Warn("slow query", attrs...)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestSlowQueryTracer(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		err      error
+		want     []string
+	}{
+		{"fast", 0, nil, nil},
+		{"slow", 30 * time.Millisecond, nil, []string{"level=WARN", `msg="slow query"`, `sql="SELECT pg_sleep(1) FROM todos"`, "duration="}},
+		{"slow and failed", 30 * time.Millisecond, errors.New("canceling statement"), []string{"level=WARN", `error="canceling statement"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			tracer := &slowQueryTracer{
+				logger:    slog.New(slog.NewTextHandler(&buf, nil)),
+				threshold: 20 * time.Millisecond,
+			}
+
+			sql := "SELECT pg_sleep(1)\n\tFROM todos"
+
+			ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: sql, Args: []any{"secret"}})
+			time.Sleep(tt.duration)
+			tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: tt.err})
+
+			out := buf.String()
+
+			if tt.want == nil {
+				if out != "" {
+					t.Errorf("got log %q; want nothing", out)
+				}
+				return
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("got log %q; want it to contain %s", out, want)
+				}
+			}
+
+			if strings.Contains(out, "secret") {
+				t.Errorf("got log %q; want the query arguments left out", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type rateClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipLimiter rate limits requests per client IP. Clients that haven't been seen
+// for a few minutes are forgotten by a cleanup goroutine, which runs until
+// stop is called.
+type ipLimiter struct {
+	mu       sync.Mutex
+	rps      float64
+	burst    int
+	clients  map[string]*rateClient
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newIPLimiter(rps float64, burst int) *ipLimiter {
+	l := &ipLimiter{
+		rps:     rps,
+		burst:   burst,
+		clients: make(map[string]*rateClient),
+		done:    make(chan struct{}),
+	}
+
+	go l.cleanup(time.Minute)
+
+	return l
+}
+
+// allow reports whether the client may make another request now.
+func (l *ipLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, found := l.clients[ip]
+	if !found {
+		client = &rateClient{limiter: rate.NewLimiter(rate.Limit(l.rps), l.burst)}
+		l.clients[ip] = client
+	}
+
+	client.lastSeen = time.Now()
+
+	return client.limiter.Allow()
+}
+
+// stop ends the cleanup goroutine.
+func (l *ipLimiter) stop() {
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+func (l *ipLimiter) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case now := <-ticker.C:
+			l.prune(now)
+		}
+	}
+}
+
+func (l *ipLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ip, client := range l.clients {
+		if now.Sub(client.lastSeen) > 3*time.Minute {
+			delete(l.clients, ip)
+		}
+	}
+}
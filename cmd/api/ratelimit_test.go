@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIPLimiter(t *testing.T) {
+	limiter := newIPLimiter(1, 2)
+	defer limiter.stop()
+
+	for i := range 2 {
+		if !limiter.allow("192.0.2.1") {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+
+	if limiter.allow("192.0.2.1") {
+		t.Error("a request over the burst was allowed")
+	}
+
+	if !limiter.allow("192.0.2.2") {
+		t.Error("another client's request was refused")
+	}
+
+	limiter.prune(time.Now().Add(5 * time.Minute))
+
+	if len(limiter.clients) != 0 {
+		t.Errorf("got %d clients after pruning; want 0", len(limiter.clients))
+	}
+}
+
+func TestIPLimiterStop(t *testing.T) {
+	limiter := newIPLimiter(1, 2)
+
+	returned := make(chan struct{})
+
+	go func() {
+		limiter.cleanup(time.Millisecond)
+		close(returned)
+	}()
+
+	limiter.stop()
+	limiter.stop()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Error("the cleanup goroutine didn't return after stop")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseCIDRs parses a comma-separated list of CIDR prefixes. Bare addresses are
+// accepted as single-address prefixes.
+func parseCIDRs(value string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", part, err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", part, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func (app *application) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the address of the peer the request came from, which is
+// the proxy itself when there is one.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// fromTrustedProxy reports whether the request was sent by one of the
+// configured trusted proxies, meaning its X-Forwarded-* headers can be used.
+func (app *application) fromTrustedProxy(r *http.Request) bool {
+	return app.isTrustedProxy(remoteIP(r))
+}
+
+// realIP returns the client's IP address. Forwarding headers are only looked
+// at when the request comes from a trusted proxy, otherwise anyone could spoof
+// them. X-Forwarded-For is read right to left, skipping trusted proxies, so
+// entries the client added itself are ignored.
+func (app *application) realIP(r *http.Request) string {
+	ip := remoteIP(r)
+
+	if !app.isTrustedProxy(ip) {
+		return ip
+	}
+
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		hops := strings.Split(forwardedFor, ",")
+
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+
+			ip = hop
+
+			if !app.isTrustedProxy(hop) {
+				return ip
+			}
+		}
+
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+
+	return ip
+}
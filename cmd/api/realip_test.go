@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIPHeader string
+		want         string
+	}{
+		{"direct", "192.0.2.1:1234", "", "", "192.0.2.1"},
+		{"spoofed X-Forwarded-For from an untrusted peer", "192.0.2.1:1234", "203.0.113.5", "", "192.0.2.1"},
+		{"spoofed X-Real-IP from an untrusted peer", "192.0.2.1:1234", "", "203.0.113.5", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", "203.0.113.5", "", "203.0.113.5"},
+		{"trusted proxy chain", "10.0.0.1:1234", "203.0.113.5, 10.0.0.2", "", "203.0.113.5"},
+		{"client-supplied hop behind a trusted proxy", "10.0.0.1:1234", "198.51.100.7, 203.0.113.5", "", "203.0.113.5"},
+		{"trusted proxy with X-Real-IP", "10.0.0.1:1234", "", "203.0.113.5", "203.0.113.5"},
+		{"trusted proxy with a malformed header", "10.0.0.1:1234", "not-an-ip", "", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			var err error
+
+			app.config.trustedProxies, err = parseCIDRs("10.0.0.0/8")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if tt.realIPHeader != "" {
+				r.Header.Set("X-Real-IP", tt.realIPHeader)
+			}
+
+			if got := app.realIP(r); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	prefixes, err := parseCIDRs("10.0.0.0/8, 192.0.2.7,, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"10.0.0.0/8", "192.0.2.7/32", "::1/128"}
+
+	if len(prefixes) != len(want) {
+		t.Fatalf("got %v; want %v", prefixes, want)
+	}
+
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("prefix %d: got %s; want %s", i, prefix, want[i])
+		}
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if _, err := parseCIDRs(value); err == nil {
+			t.Errorf("parseCIDRs(%q): got no error", value)
+		}
+	}
+}
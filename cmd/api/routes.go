@@ -1,6 +1,8 @@
 package main
 
 import (
+	"GoTodo/internal/data"
+	"expvar"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -9,18 +11,83 @@ import (
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
-	router.NotFound = http.HandlerFunc(app.notFoundResponse)
+	// httprouter doesn't allow a wildcard to share a path segment with static
+	// routes (e.g. /v1/todos/:id and /v1/todos/stats), so routes scoped to a
+	// single todo live in their own router, which handles every request the
+	// main router can't match.
+	todoRouter := httprouter.New()
+
+	router.NotFound = todoRouter
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
+	todoRouter.NotFound = http.HandlerFunc(app.notFoundResponse)
+	todoRouter.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthz", app.livenessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/readyz", app.readinessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/version", app.versionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/debug/schema-version", app.schemaVersionHandler)
+
+	if app.config.env != "production" || app.config.metrics.enabled {
+		router.Handler(http.MethodGet, "/v1/debug/vars", expvar.Handler())
+	}
+
 	router.HandlerFunc(http.MethodPost, "/v1/todos", app.protectedRouteMiddleware(app.createTodoHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todos/bulk", app.protectedRouteMiddleware(app.createTodosBulkHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todos/bulk-delete", app.protectedRouteMiddleware(app.deleteTodosBulkHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todos/import", app.protectedRouteMiddleware(app.importTodosHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todos/reorder", app.protectedRouteMiddleware(app.reorderTodosHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todos/complete-all", app.protectedRouteMiddleware(app.completeAllTodosHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todos/uncomplete-all", app.protectedRouteMiddleware(app.uncompleteAllTodosHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/todos", app.protectedRouteMiddleware(app.listTodosHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/todos/:id", app.protectedRouteMiddleware(app.deleteTodoHandler))
-	router.HandlerFunc(http.MethodPut, "/v1/todos/:id", app.protectedRouteMiddleware(app.updateTodoHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todos/stats", app.protectedRouteMiddleware(app.showTodoStatsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todos/suggest", app.protectedRouteMiddleware(app.suggestTodosHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todos/export", app.protectedRouteMiddleware(app.exportTodosHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todos/due-soon", app.protectedRouteMiddleware(app.dueSoonTodosHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todos/overdue", app.protectedRouteMiddleware(app.overdueTodosHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todos/completed", app.protectedRouteMiddleware(app.completedTodosHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todos/calendar.ics", app.calendarHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/todos/stream", app.protectedRouteMiddleware(app.streamTodosHandler))
+
+	todoRouter.HandlerFunc(http.MethodGet, "/v1/todos/:id", app.protectedRouteMiddleware(app.showTodoHandler))
+	todoRouter.HandlerFunc(http.MethodDelete, "/v1/todos/:id", app.protectedRouteMiddleware(app.deleteTodoHandler))
+	todoRouter.HandlerFunc(http.MethodPut, "/v1/todos/:id", app.protectedRouteMiddleware(app.replaceTodoHandler))
+	todoRouter.HandlerFunc(http.MethodPatch, "/v1/todos/:id", app.protectedRouteMiddleware(app.updateTodoHandler))
+	todoRouter.HandlerFunc(http.MethodPost, "/v1/todos/:id/duplicate", app.protectedRouteMiddleware(app.duplicateTodoHandler))
+	todoRouter.HandlerFunc(http.MethodPost, "/v1/todos/:id/share", app.protectedRouteMiddleware(app.shareTodoHandler))
+	todoRouter.HandlerFunc(http.MethodDelete, "/v1/todos/:id/share", app.protectedRouteMiddleware(app.unshareTodoHandler))
+	todoRouter.HandlerFunc(http.MethodPost, "/v1/todos/:id/subtasks", app.protectedRouteMiddleware(app.createSubtaskHandler))
+	todoRouter.HandlerFunc(http.MethodPut, "/v1/todos/:id/subtasks", app.protectedRouteMiddleware(app.reorderSubtasksHandler))
+	todoRouter.HandlerFunc(http.MethodPatch, "/v1/todos/:id/subtasks/:subtask_id", app.protectedRouteMiddleware(app.updateSubtaskHandler))
+	todoRouter.HandlerFunc(http.MethodDelete, "/v1/todos/:id/subtasks/:subtask_id", app.protectedRouteMiddleware(app.deleteSubtaskHandler))
+	todoRouter.HandlerFunc(http.MethodPost, "/v1/todos/:id/attachments", app.protectedRouteMiddleware(app.createAttachmentHandler))
+	todoRouter.HandlerFunc(http.MethodGet, "/v1/todos/:id/attachments", app.protectedRouteMiddleware(app.listAttachmentsHandler))
+	todoRouter.HandlerFunc(http.MethodDelete, "/v1/todos/:id/attachments/:attachment_id", app.protectedRouteMiddleware(app.deleteAttachmentHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/projects", app.protectedRouteMiddleware(app.createProjectHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/projects", app.protectedRouteMiddleware(app.listProjectsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/projects/:id", app.protectedRouteMiddleware(app.showProjectHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/projects/:id", app.protectedRouteMiddleware(app.updateProjectHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/projects/:id", app.protectedRouteMiddleware(app.deleteProjectHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.createUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/email-available", app.rateLimit(app.checkEmailAvailabilityHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.protectedRouteMiddleware(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.protectedRouteMiddleware(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/calendar-token", app.protectedRouteMiddleware(app.createCalendarTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa/enable", app.protectedRouteMiddleware(app.enableTwoFactorHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa/verify", app.protectedRouteMiddleware(app.verifyTwoFactorHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/auth/sign-in", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/auth/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/auth/sessions", app.protectedRouteMiddleware(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/auth/sessions", app.protectedRouteMiddleware(app.deleteAllSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/auth/sessions/:id", app.protectedRouteMiddleware(app.deleteSessionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.protectedRouteMiddleware(app.requireRole(data.RoleAdmin, app.listUsersHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit", app.protectedRouteMiddleware(app.requireRole(data.RoleAdmin, app.listAuditLogHandler)))
 
-	return router
+	return app.metrics(app.requestID(app.secureHeaders(app.logRequest(app.requestTimeout(router)))))
 }
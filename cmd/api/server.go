@@ -1,22 +1,82 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
-func (app *application) serve() error {
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", app.config.port),
-		Handler: app.routes(),
+func (app *application) newServer() *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", app.config.port),
+		Handler:           app.routes(),
+		ReadTimeout:       app.config.server.readTimeout,
+		ReadHeaderTimeout: app.config.server.readHeaderTimeout,
+		WriteTimeout:      app.config.server.writeTimeout,
+		IdleTimeout:       app.config.server.idleTimeout,
+		ErrorLog:          slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
+}
+
+// serve runs the server until it receives SIGINT or SIGTERM. It then stops
+// accepting connections, gives in-flight requests up to the shutdown timeout
+// to finish and waits for background tasks before returning.
+func (app *application) serve() error {
+	srv := app.newServer()
+
+	// Event streams never finish on their own, so they're closed as soon as
+	// the shutdown starts instead of holding it up until the timeout.
+	srv.RegisterOnShutdown(app.events.shutdown)
+	srv.RegisterOnShutdown(app.rateLimiter.stop)
+
+	shutdownError := make(chan error)
+
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.server.shutdownTimeout)
+		defer cancel()
+
+		shutdownError <- app.shutdown(ctx, srv)
+	}()
 
 	app.logger.Info("starting server", "addr", srv.Addr, "env", app.config.env)
 
 	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	err = <-shutdownError
 	if err != nil {
 		return err
 	}
 
+	app.logger.Info("stopped server", "addr", srv.Addr)
+
+	return nil
+}
+
+// shutdown stops srv, giving in-flight requests until ctx is done, and then
+// waits for background tasks to finish.
+func (app *application) shutdown(ctx context.Context, srv *http.Server) error {
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("completing background tasks", "addr", srv.Addr)
+
+	app.wg.Wait()
+
 	return nil
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewServerTimeouts(t *testing.T) {
+	app := newTestApplication(t)
+
+	srv := app.newServer()
+
+	tests := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"ReadTimeout", srv.ReadTimeout, app.config.server.readTimeout},
+		{"ReadHeaderTimeout", srv.ReadHeaderTimeout, app.config.server.readHeaderTimeout},
+		{"WriteTimeout", srv.WriteTimeout, app.config.server.writeTimeout},
+		{"IdleTimeout", srv.IdleTimeout, app.config.server.idleTimeout},
+	}
+
+	for _, tt := range tests {
+		if tt.got == 0 {
+			t.Errorf("%s isn't set", tt.name)
+		}
+
+		if tt.got != tt.want {
+			t.Errorf("%s: got %s; want %s", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if srv.WriteTimeout <= app.config.server.requestTimeout {
+		t.Errorf("WriteTimeout %s isn't longer than the request timeout %s", srv.WriteTimeout, app.config.server.requestTimeout)
+	}
+
+	if srv.ErrorLog == nil {
+		t.Error("ErrorLog isn't set")
+	}
+}
+
+func TestShutdownWaitsForBackgroundTasks(t *testing.T) {
+	app := newTestApplication(t)
+
+	srv := app.newServer()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Serve(ln)
+
+	release := make(chan struct{})
+	finished := false
+
+	app.background(func() {
+		<-release
+		finished = true
+	})
+
+	done := make(chan error)
+
+	go func() {
+		done <- app.shutdown(context.Background(), srv)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("shutdown returned before the background task finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("got error %v; want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown didn't return once the background task finished")
+	}
+
+	if !finished {
+		t.Error("shutdown returned before the background task finished")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/data/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) shareTodoHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeTodoShare(w, r, true)
+}
+
+func (app *application) unshareTodoHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeTodoShare(w, r, false)
+}
+
+// changeTodoShare grants (or revokes) read-only access to one of the caller's
+// todos for the user identified by the email in the request body.
+func (app *application) changeTodoShare(w http.ResponseWriter, r *http.Request, share bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	todo, err := app.models.Todos.Get(r.Context(), id, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "todo")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	if todo.Shared {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	target, err := app.models.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no user with this email address")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	if target.Id == user.Id {
+		v.AddError("email", "must not be your own email address")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	message := "todo shared successfully"
+
+	if share {
+		err = app.models.Todos.Share(r.Context(), todo.ID, user.Id, target.Id)
+	} else {
+		err = app.models.Todos.Unshare(r.Context(), todo.ID, user.Id, target.Id)
+		message = "todo unshared successfully"
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestShareTodo(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	_, id := createTodo(t, app, alice, "Plan the trip")
+	path := fmt.Sprintf("/v1/todos/%d", id)
+
+	if status := do(t, app, http.MethodGet, path, bob, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("before sharing: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	status := do(t, app, http.MethodPost, path+"/share", alice, map[string]string{"email": "bob@example.com"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("sharing: got status %d; want %d", status, http.StatusOK)
+	}
+
+	var response struct {
+		Todo struct {
+			Title  string `json:"title"`
+			Shared bool   `json:"shared"`
+		} `json:"todo"`
+	}
+
+	if status := do(t, app, http.MethodGet, path, bob, nil, &response); status != http.StatusOK {
+		t.Fatalf("sharee: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if !response.Todo.Shared {
+		t.Error("sharee: todo isn't marked shared")
+	}
+
+	if got := listTodos(t, app, bob, "").titles(); !slices.Equal(got, []string{"Plan the trip"}) {
+		t.Errorf("sharee's list: got %v; want [Plan the trip]", got)
+	}
+
+	status = do(t, app, http.MethodPatch, path, bob, map[string]any{"title": "Cancel the trip"}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("sharee updating: got status %d; want %d", status, http.StatusForbidden)
+	}
+
+	if status := do(t, app, http.MethodDelete, path, bob, nil, nil); status == http.StatusOK {
+		t.Error("sharee deleting: got status 200")
+	}
+
+	response.Todo.Title = ""
+
+	if status := do(t, app, http.MethodGet, path, alice, nil, &response); status != http.StatusOK {
+		t.Fatalf("owner: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if response.Todo.Title != "Plan the trip" || response.Todo.Shared {
+		t.Errorf("owner: got title %q, shared %t; want the unchanged, owned todo", response.Todo.Title, response.Todo.Shared)
+	}
+}
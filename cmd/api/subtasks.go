@@ -0,0 +1,234 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/data/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) createSubtaskHandler(w http.ResponseWriter, r *http.Request) {
+	todoId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	var input struct {
+		Title       string `json:"title"`
+		IsCompleted bool   `json:"is_completed"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	subtask := &data.Subtask{
+		Title:       input.Title,
+		IsCompleted: input.IsCompleted,
+	}
+
+	v := validator.New()
+
+	if data.ValidateSubtask(v, subtask); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Subtasks.Insert(r.Context(), todoId, user.Id, subtask)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "todo")
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"subtask": subtask}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSubtaskHandler(w http.ResponseWriter, r *http.Request) {
+	todoId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "subtask_id")
+	if err != nil {
+		app.notFoundResponseFor(w, r, "subtask")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	subtask, err := app.models.Subtasks.Get(r.Context(), id, todoId, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "subtask")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		IsCompleted *bool   `json:"is_completed"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		subtask.Title = *input.Title
+	}
+
+	if input.IsCompleted != nil {
+		subtask.IsCompleted = *input.IsCompleted
+	}
+
+	v := validator.New()
+
+	if data.ValidateSubtask(v, subtask); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Subtasks.Update(r.Context(), todoId, user.Id, subtask)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "subtask")
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"subtask": subtask}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reorderSubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	todoId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateSubtaskOrder(v, input.IDs); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	todo, err := app.models.Todos.Get(r.Context(), todoId, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "todo")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	if todo.Shared {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Subtasks.Reorder(r.Context(), todoId, user.Id, input.IDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("ids", "must list every subtask of the todo exactly once")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	todo, err = app.models.Todos.Get(r.Context(), todoId, user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"subtasks": todo.Subtasks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSubtaskHandler(w http.ResponseWriter, r *http.Request) {
+	todoId, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "subtask_id")
+	if err != nil {
+		app.notFoundResponseFor(w, r, "subtask")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Subtasks.Delete(r.Context(), id, todoId, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "subtask")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "subtask deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
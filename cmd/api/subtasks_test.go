@@ -0,0 +1,82 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestSubtasks(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	_, todoID := createTodo(t, app, alice, "Move house")
+	path := fmt.Sprintf("/v1/todos/%d/subtasks", todoID)
+
+	ids := map[string]int64{}
+
+	for _, title := range []string{"Pack", "Hire a van", "Clean"} {
+		var response struct {
+			Subtask data.Subtask `json:"subtask"`
+		}
+
+		status := do(t, app, http.MethodPost, path, alice, map[string]any{"title": title}, &response)
+		if status != http.StatusCreated {
+			t.Fatalf("adding %q: got status %d; want %d", title, status, http.StatusCreated)
+		}
+
+		ids[title] = response.Subtask.ID
+	}
+
+	subtaskPath := fmt.Sprintf("%s/%d", path, ids["Pack"])
+
+	var completed struct {
+		Subtask data.Subtask `json:"subtask"`
+	}
+
+	status := do(t, app, http.MethodPatch, subtaskPath, alice, map[string]any{"is_completed": true}, &completed)
+	if status != http.StatusOK {
+		t.Fatalf("completing: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if !completed.Subtask.IsCompleted {
+		t.Error("completing: subtask isn't completed")
+	}
+
+	var reordered struct {
+		Subtasks []data.Subtask `json:"subtasks"`
+	}
+
+	order := []int64{ids["Hire a van"], ids["Pack"], ids["Clean"]}
+
+	status = do(t, app, http.MethodPut, path, alice, map[string]any{"ids": order}, &reordered)
+	if status != http.StatusOK {
+		t.Fatalf("reordering: got status %d; want %d", status, http.StatusOK)
+	}
+
+	var got []int64
+	for _, subtask := range reordered.Subtasks {
+		got = append(got, subtask.ID)
+	}
+
+	if !slices.Equal(got, order) {
+		t.Errorf("reordering: got %v; want %v", got, order)
+	}
+
+	// Another user can't see or change the subtasks.
+	if status := do(t, app, http.MethodPost, path, bob, map[string]any{"title": "Sabotage"}, nil); status != http.StatusNotFound {
+		t.Errorf("other user adding: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	if status := do(t, app, http.MethodPatch, subtaskPath, bob, map[string]any{"is_completed": false}, nil); status != http.StatusNotFound {
+		t.Errorf("other user completing: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	if status := do(t, app, http.MethodPut, path, bob, map[string]any{"ids": order}, nil); status != http.StatusNotFound {
+		t.Errorf("other user reordering: got status %d; want %d", status, http.StatusNotFound)
+	}
+}
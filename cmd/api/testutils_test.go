@@ -0,0 +1,177 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"GoTodo/internal/testdb"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestApplication returns an application with the same defaults as the
+// command-line flags, logging to nowhere and without a database.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	var cfg config
+
+	cfg.env = "testing"
+	cfg.maxBodyBytes = 1_048_576
+	cfg.server.readTimeout = 5 * time.Second
+	cfg.server.readHeaderTimeout = 2 * time.Second
+	cfg.server.writeTimeout = 45 * time.Second
+	cfg.server.idleTimeout = time.Minute
+	cfg.server.requestTimeout = 30 * time.Second
+	cfg.auth.mode = authModeStateful
+	cfg.auth.tokenTTL = 15 * time.Minute
+	cfg.auth.refreshTokenTTL = 7 * 24 * time.Hour
+	cfg.todos.maxTitleLength = data.DefaultValidateTodoOptions().MaxTitleLength
+	cfg.todos.maxDescriptionLength = data.DefaultValidateTodoOptions().MaxDescriptionLength
+	cfg.pagination.defaultPageSize = 10
+	cfg.pagination.maxPageSize = 100
+	cfg.registrationEnabled = true
+	cfg.secureHeaders.enabled = true
+	cfg.secureHeaders.contentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	rateLimiter := newIPLimiter(2, 4)
+	t.Cleanup(rateLimiter.stop)
+
+	return &application{
+		config:       cfg,
+		logger:       logger,
+		loginLimiter: newLoginLimiter(5, 15*time.Minute, 15*time.Minute),
+		rateLimiter:  rateLimiter,
+		events:       newTodoBroker(),
+		mailer:       logMailer{logger: logger},
+	}
+}
+
+// newTestDBApplication returns a test application backed by its own migrated
+// schema. The test is skipped when TEST_DB_DSN isn't set.
+func newTestDBApplication(t *testing.T) *application {
+	t.Helper()
+
+	app := newTestApplication(t)
+
+	db := testdb.New(t)
+
+	app.db = db
+	app.models = data.NewModels(db)
+
+	// Background tasks may still be using the database; wait for them before the
+	// schema is dropped.
+	t.Cleanup(app.wg.Wait)
+
+	return app
+}
+
+// insertTestUser creates a user with the password "pa55word".
+func insertTestUser(t *testing.T, app *application, email string) *data.User {
+	t.Helper()
+
+	user := &data.User{Name: "Test User", Email: email}
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// authenticate returns an authentication token for the user.
+func authenticate(t *testing.T, app *application, user *data.User) string {
+	t.Helper()
+
+	sessionID, err := data.NewSessionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := app.models.Tokens.NewForSession(context.Background(), user.Id, time.Hour, data.ScopeAuthentication, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token.Plaintext
+}
+
+// newRequest builds a request with body encoded as JSON unless it's nil.
+func newRequest(t *testing.T, method, path string, body any) *http.Request {
+	t.Helper()
+
+	var r io.Reader
+
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r = bytes.NewReader(js)
+	}
+
+	return httptest.NewRequest(method, path, r)
+}
+
+// decode decodes the recorded JSON response into dst.
+func decode(t *testing.T, rr *httptest.ResponseRecorder, dst any) {
+	t.Helper()
+
+	err := json.Unmarshal(rr.Body.Bytes(), dst)
+	if err != nil {
+		t.Fatalf("decoding response %q: %v", rr.Body, err)
+	}
+}
+
+// doAs calls handler directly for user, skipping the routes and
+// authentication, and decodes the JSON response into dst unless it's nil. It
+// suits requests that are rejected before the handler uses the database.
+func doAs(t *testing.T, app *application, handler http.HandlerFunc, user *data.User, method, path string, body any, dst any) int {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+
+	handler(rr, app.contextSetUser(newRequest(t, method, path, body), user))
+
+	if dst != nil {
+		decode(t, rr, dst)
+	}
+
+	return rr.Code
+}
+
+// do sends a request through the application's routes, authenticated with
+// token unless it's empty, and decodes the JSON response into dst unless it's
+// nil.
+func do(t *testing.T, app *application, method, path, token string, body any, dst any) int {
+	t.Helper()
+
+	req := newRequest(t, method, path, body)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+
+	app.routes().ServeHTTP(rr, req)
+
+	if dst != nil {
+		decode(t, rr, dst)
+	}
+
+	return rr.Code
+}
@@ -3,18 +3,50 @@ package main
 import (
 	"GoTodo/internal/data"
 	"GoTodo/internal/data/validator"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 func (app *application) createTodoHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title       string    `json:"title"`
-		Description string    `json:"description"`
-		DueDate     time.Time `json:"due_date"`
-		IsCompleted bool      `json:"is_completed"`
+		Title       string     `json:"title"`
+		Description string     `json:"description"`
+		DueDate     *time.Time `json:"due_date"`
+		IsCompleted bool       `json:"is_completed"`
+		Recurrence  string     `json:"recurrence"`
+		ProjectID   *int64     `json:"project_id"`
+		Tags        []string   `json:"tags"`
+	}
+
+	user := app.contextGetUser(r)
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+
+	if idempotencyKey != "" {
+		v := validator.New()
+
+		if data.ValidateIdempotencyKey(v, idempotencyKey); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		todo, err := app.getIdempotentTodo(r.Context(), user.Id, idempotencyKey)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if todo != nil {
+			app.createdTodoResponse(w, r, todo)
+			return
+		}
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -23,34 +55,274 @@ func (app *application) createTodoHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if input.Tags == nil {
+		input.Tags = []string{}
+	}
+
+	input.Tags = data.NormalizeTags(input.Tags)
+
+	if input.Recurrence == "" {
+		input.Recurrence = data.RecurrenceNone
+	}
+
 	todo := &data.Todo{
-		Title:       input.Title,
+		Title:       strings.TrimSpace(input.Title),
 		Description: input.Description,
 		DueDate:     input.DueDate,
 		IsCompleted: input.IsCompleted,
+		Recurrence:  input.Recurrence,
+		ProjectID:   input.ProjectID,
+		Tags:        input.Tags,
+		Subtasks:    []data.Subtask{},
+		Attachments: []data.Attachment{},
 	}
 
 	v := validator.New()
 
-	v.Check(todo.Title != "", "title", "must be provided")
-	v.Check(len([]rune(todo.Title)) <= 500, "title", "must not be more than 500 characters long")
+	data.ValidateTodo(v, todo, app.todoValidationOptions(false))
+	data.ValidateTags(v, todo.Tags)
+
+	err = app.checkProject(r.Context(), v, user.Id, todo.ProjectID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.WithTx(r.Context(), func(m data.Models) error {
+		err := app.checkTodoQuota(r.Context(), m, user.Id, activeTodos([]*data.Todo{todo}))
+		if err != nil {
+			return err
+		}
+
+		err = m.Todos.Insert(r.Context(), user.Id, todo)
+		if err != nil {
+			return err
+		}
+
+		err = m.Todos.AddTags(r.Context(), todo.ID, user.Id, todo.Tags)
+		if err != nil {
+			return err
+		}
+
+		if idempotencyKey != "" {
+			return m.IdempotencyKeys.Insert(r.Context(), user.Id, idempotencyKey, todo.ID, 24*time.Hour)
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		case errors.Is(err, data.ErrIdempotencyKeyUsed):
+			// A concurrent request with the same key created its todo first,
+			// so this one's was rolled back and the original is sent instead.
+			app.idempotentTodoResponse(w, r, user.Id, idempotencyKey)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	app.audit(r, &user.Id, data.AuditTodoCreate, "todo", &todo.ID)
+	app.events.publish(user.Id, todoEvent{Type: todoEventCreated, TodoID: todo.ID, Todo: todo})
+
+	app.createdTodoResponse(w, r, todo)
+}
+
+func (app *application) createdTodoResponse(w http.ResponseWriter, r *http.Request, todo *data.Todo) {
+	headers := make(http.Header)
+	headers.Set("Location", app.absoluteURL(r, fmt.Sprintf("/v1/todos/%d", todo.ID)))
+
+	err := app.writeJSON(w, r, http.StatusCreated, envelope{"todo": todo}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// idempotentTodoResponse sends the todo created with the given idempotency key
+// by another request. If that todo has since been deleted, the request
+// conflicts with it.
+func (app *application) idempotentTodoResponse(w http.ResponseWriter, r *http.Request, userId int64, key string) {
+	todo, err := app.getIdempotentTodo(r.Context(), userId, key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if todo == nil {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	app.createdTodoResponse(w, r, todo)
+}
+
+// getIdempotentTodo returns the todo previously created with the given
+// idempotency key, or nil if the key hasn't been used yet.
+func (app *application) getIdempotentTodo(ctx context.Context, userId int64, key string) (*data.Todo, error) {
+	todoId, err := app.models.IdempotencyKeys.GetTodoID(ctx, userId, key)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	todo, err := app.models.Todos.Get(ctx, todoId, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+func (app *application) createTodosBulkHandler(w http.ResponseWriter, r *http.Request) {
+	var input []struct {
+		Title       string     `json:"title"`
+		Description string     `json:"description"`
+		DueDate     *time.Time `json:"due_date"`
+		IsCompleted bool       `json:"is_completed"`
+		Recurrence  string     `json:"recurrence"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(input) == 0 {
+		app.failedValidationResponse(w, r, map[string]string{"todos": "must contain at least one todo"})
+		return
+	}
+
+	todos := make([]*data.Todo, len(input))
+	batchErrors := make(map[int]map[string]string)
+
+	for i, item := range input {
+		if item.Recurrence == "" {
+			item.Recurrence = data.RecurrenceNone
+		}
+
+		todos[i] = &data.Todo{
+			Title:       strings.TrimSpace(item.Title),
+			Description: item.Description,
+			DueDate:     item.DueDate,
+			IsCompleted: item.IsCompleted,
+			Recurrence:  item.Recurrence,
+			Tags:        []string{},
+			Subtasks:    []data.Subtask{},
+			Attachments: []data.Attachment{},
+		}
+
+		v := validator.New()
+
+		if data.ValidateTodo(v, todos[i], app.todoValidationOptions(false)); !v.Valid() {
+			batchErrors[i] = v.Errors
+		}
+	}
+
+	if len(batchErrors) > 0 {
+		app.failedBatchValidationResponse(w, r, batchErrors)
+		return
 	}
 
 	user := app.contextGetUser(r)
 
-	err = app.models.Todos.Insert(user.Id, todo)
+	err = app.models.WithTx(r.Context(), func(m data.Models) error {
+		err := app.checkTodoQuota(r.Context(), m, user.Id, activeTodos(todos))
+		if err != nil {
+			return err
+		}
+
+		return m.Todos.InsertBatch(r.Context(), user.Id, todos)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	for _, todo := range todos {
+		app.audit(r, &user.Id, data.AuditTodoCreate, "todo", &todo.ID)
+		app.events.publish(user.Id, todoEvent{Type: todoEventCreated, TodoID: todo.ID, Todo: todo})
+	}
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"todos": todos}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTodoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	v := validator.New()
+
+	fields := app.readFields(r.URL.Query(), "fields", data.TodoFieldSafeList, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	todo, err := app.models.Todos.Get(r.Context(), id, user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "todo")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	etag := todoETag(todo)
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/todos/%d", todo.ID))
+	headers.Set("ETag", etag)
+
+	selected, err := selectFields(todo, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"todo": todo}, headers)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"todo": selected}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -58,23 +330,64 @@ func (app *application) createTodoHandler(w http.ResponseWriter, r *http.Request
 
 func (app *application) listTodosHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Search string
+		Search    string
+		Tags      []string
+		ProjectID *int64
 		data.Filters
 	}
 
 	qs := r.URL.Query()
 
-	input.Search = app.readString(qs, "search", "")
+	if qs.Has("ids") {
+		app.listTodosByIDs(w, r)
+		return
+	}
+
+	input.Search = strings.TrimSpace(app.readString(qs, "search", ""))
+	input.Tags = data.NormalizeTags(qs["tag"])
 
 	v := validator.New()
 
+	data.ValidateSearch(v, input.Search)
+	data.ValidateTags(v, input.Tags)
+
+	if qs.Has("project_id") {
+		projectID := int64(app.readInt(qs, "project_id", 0, v))
+		v.Check(projectID > 0, "project_id", "must be greater than 0")
+		input.ProjectID = &projectID
+	}
+
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 10, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", app.config.pagination.defaultPageSize, v)
+	input.Filters.MaxPageSize = app.config.pagination.maxPageSize
 	input.Filters.Sort = app.readString(qs, "sort", "created_at")
 	input.Filters.Order = app.readString(qs, "order", "desc")
-	input.Filters.SortSafeList = []string{"is_complete", "due_date", "created_at"}
+	input.Filters.SortSafeList = []string{"is_completed", "due_date", "created_at", "title", "position", "smart"}
 	input.Filters.OrderSafeList = []string{"asc", "desc"}
 
+	if input.Search != "" {
+		input.Filters.SortSafeList = append(input.Filters.SortSafeList, "relevance")
+	} else if input.Filters.Sort == "relevance" {
+		input.Filters.Sort = "created_at"
+	}
+
+	if qs.Has("after_id") {
+		afterID := int64(app.readInt(qs, "after_id", 0, v))
+		input.Filters.AfterID = &afterID
+	}
+
+	if qs.Has("created_after") {
+		createdAfter := app.readTime(qs, "created_after", time.Time{}, v)
+		input.Filters.CreatedAfter = &createdAfter
+	}
+
+	if qs.Has("created_before") {
+		createdBefore := app.readTime(qs, "created_before", time.Time{}, v)
+		input.Filters.CreatedBefore = &createdBefore
+	}
+
+	fields := app.readFields(qs, "fields", data.TodoFieldSafeList, v)
+
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -82,13 +395,271 @@ func (app *application) listTodosHandler(w http.ResponseWriter, r *http.Request)
 
 	user := app.contextGetUser(r)
 
-	todos, metadata, err := app.models.Todos.GetAll(user.Id, input.Search, input.Filters)
+	todos, metadata, err := app.models.Todos.GetAll(r.Context(), user.Id, input.Search, input.Tags, input.ProjectID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidatePageInRange(v, input.Filters, metadata); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	selected, err := selectFields(todos, fields)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"todos": todos, "metada": metadata}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"todos": selected, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) completeAllTodosHandler(w http.ResponseWriter, r *http.Request) {
+	app.setAllTodosCompleted(w, r, true)
+}
+
+func (app *application) uncompleteAllTodosHandler(w http.ResponseWriter, r *http.Request) {
+	app.setAllTodosCompleted(w, r, false)
+}
+
+// setAllTodosCompleted flips every todo the user owns in one go. Unlike
+// completing a single todo, it doesn't create the next occurrence of
+// recurring todos. Reopening them all fails if that would exceed the quota.
+func (app *application) setAllTodosCompleted(w http.ResponseWriter, r *http.Request, completed bool) {
+	user := app.contextGetUser(r)
+
+	var ids []int64
+
+	err := app.models.WithTx(r.Context(), func(m data.Models) error {
+		var err error
+
+		ids, err = m.Todos.SetAllCompleted(r.Context(), user.Id, completed)
+		if err != nil {
+			return err
+		}
+
+		// Reopened todos count towards the quota again, so check it with
+		// them included and roll back if it's exceeded.
+		if !completed {
+			return app.checkTodoQuota(r.Context(), m, user.Id, 0)
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	if len(ids) > 0 {
+		app.audit(r, &user.Id, data.AuditTodoUpdate, "todos", nil)
+
+		for _, id := range ids {
+			app.events.publish(user.Id, todoEvent{Type: todoEventUpdated, TodoID: id})
+		}
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"updated": len(ids)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTodosByIDs serves GET /v1/todos?ids=1,2,3, returning the requested todos
+// in the order given. It doesn't paginate or filter.
+func (app *application) listTodosByIDs(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	ids := app.readIDList(r.URL.Query(), "ids", v)
+	fields := app.readFields(r.URL.Query(), "fields", data.TodoFieldSafeList, v)
+
+	if v.Valid() {
+		v.Check(len(ids) > 0, "ids", "must contain at least one id")
+		v.Check(len(ids) <= 100, "ids", "must not contain more than 100 ids")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	todos, err := app.models.Todos.GetByIDs(r.Context(), ids, user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	selected, err := selectFields(todos, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"todos": selected}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTodoStatsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	stats, err := app.models.Todos.Stats(r.Context(), user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) suggestTodosHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	prefix := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(utf8.RuneCountInString(prefix) >= 2, "q", "must be at least 2 characters long")
+	v.Check(utf8.RuneCountInString(prefix) <= 500, "q", "must not be more than 500 characters long")
+	v.Check(limit > 0, "limit", "must be greater than 0")
+	v.Check(limit <= 20, "limit", "must not be more than 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	suggestions, err := app.models.Todos.Suggest(r.Context(), user.Id, prefix, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) dueSoonTodosHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	within := app.readDuration(qs, "within", 24*time.Hour, v)
+
+	if v.Valid() {
+		v.Check(within > 0, "within", "must be greater than 0")
+		v.Check(within <= 366*24*time.Hour, "within", "must not be more than 366 days")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	todos, err := app.models.Todos.DueSoon(r.Context(), user.Id, within)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"todos": todos}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) completedTodosHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	from := app.readTime(qs, "from", time.Time{}, v)
+	to := app.readTime(qs, "to", time.Time{}, v)
+
+	if v.Valid() {
+		v.Check(!from.IsZero(), "from", "must be provided")
+		v.Check(!to.IsZero(), "to", "must be provided")
+		v.Check(!from.After(to), "from", "must not be after to")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	todos, err := app.models.Todos.CompletedBetween(r.Context(), user.Id, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"todos": todos}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) overdueTodosHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	qs := r.URL.Query()
+
+	v := validator.New()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", app.config.pagination.defaultPageSize, v)
+	input.Filters.MaxPageSize = app.config.pagination.maxPageSize
+	input.Filters.Sort = "due_date"
+	input.Filters.Order = "asc"
+	input.Filters.SortSafeList = []string{"due_date"}
+	input.Filters.OrderSafeList = []string{"asc"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	todos, metadata, err := app.models.Todos.Overdue(r.Context(), user.Id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidatePageInRange(v, input.Filters, metadata); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"todos": todos, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -97,16 +668,27 @@ func (app *application) listTodosHandler(w http.ResponseWriter, r *http.Request)
 func (app *application) deleteTodoHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.notFoundResponseFor(w, r, "todo")
 		return
 	}
 	user := app.contextGetUser(r)
 
-	err = app.models.Todos.Delete(user.Id, id)
+	env := envelope{"message": "todo deleted successfuly"}
+
+	// With ?return=true the deleted todo is sent back, so clients can offer
+	// to undo the delete.
+	if returnTodo, _ := strconv.ParseBool(r.URL.Query().Get("return")); returnTodo {
+		var todo *data.Todo
+
+		todo, err = app.models.Todos.DeleteReturning(r.Context(), id, user.Id)
+		env["todo"] = todo
+	} else {
+		err = app.models.Todos.Delete(r.Context(), id, user.Id)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.notFoundResponseFor(w, r, "todo")
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -114,26 +696,158 @@ func (app *application) deleteTodoHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "todo deleted successfuly"}, nil)
+	app.audit(r, &user.Id, data.AuditTodoDelete, "todo", &id)
+	app.events.publish(user.Id, todoEvent{Type: todoEventDeleted, TodoID: id})
+
+	err = app.writeJSON(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTodosBulkHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.IDs) > 0, "ids", "must contain at least one id")
+	v.Check(len(input.IDs) <= 1000, "ids", "must not contain more than 1000 ids")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	deleted, err := app.models.Todos.DeleteMany(r.Context(), input.IDs, user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, id := range deleted {
+		app.audit(r, &user.Id, data.AuditTodoDelete, "todo", &id)
+		app.events.publish(user.Id, todoEvent{Type: todoEventDeleted, TodoID: id})
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"deleted": len(deleted)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) duplicateTodoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponseFor(w, r, "todo")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	var todo *data.Todo
+
+	err = app.models.WithTx(r.Context(), func(m data.Models) error {
+		// Copies always start out active.
+		err := app.checkTodoQuota(r.Context(), m, user.Id, 1)
+		if err != nil {
+			return err
+		}
+
+		todo, err = m.Todos.Duplicate(r.Context(), id, user.Id, app.config.todos.maxTitleLength)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponseFor(w, r, "todo")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	app.audit(r, &user.Id, data.AuditTodoCreate, "todo", &todo.ID)
+	app.events.publish(user.Id, todoEvent{Type: todoEventCreated, TodoID: todo.ID, Todo: todo})
+
+	headers := make(http.Header)
+	headers.Set("Location", app.absoluteURL(r, fmt.Sprintf("/v1/todos/%d", todo.ID)))
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"todo": todo}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reorderTodosHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTodoOrder(v, input.IDs); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	moved, err := app.models.Todos.Reorder(r.Context(), user.Id, input.IDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"moved": moved}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) updateTodoHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateTodo(w, r, false)
+}
+
+func (app *application) replaceTodoHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateTodo(w, r, true)
+}
+
+// updateTodo applies the request body to an existing todo. When replace is
+// true the body must be a full representation of the todo (PUT), otherwise
+// only the fields present in the body are changed (PATCH).
+func (app *application) updateTodo(w http.ResponseWriter, r *http.Request, replace bool) {
 	id, err := app.readIDParam(r)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.notFoundResponseFor(w, r, "todo")
 		return
 	}
 
 	user := app.contextGetUser(r)
 
-	todo, err := app.models.Todos.Get(user.Id, id)
+	todo, err := app.models.Todos.Get(r.Context(), id, user.Id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.notFoundResponseFor(w, r, "todo")
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -141,11 +855,24 @@ func (app *application) updateTodoHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if todo.Shared {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, todoETag(todo)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Title       *string    `json:"title"`
 		Description *string    `json:"description"`
 		DueDate     *time.Time `json:"due_date"`
 		IsCompleted *bool      `json:"is_completed"`
+		Recurrence  *string    `json:"recurrence"`
+		ProjectID   *int64     `json:"project_id"`
+		Tags        []string   `json:"tags"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -154,8 +881,26 @@ func (app *application) updateTodoHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	input.Tags = data.NormalizeTags(input.Tags)
+
+	v := validator.New()
+
+	if replace {
+		v.Check(input.Title != nil, "title", "must be provided")
+		v.Check(input.Description != nil, "description", "must be provided")
+		v.Check(input.IsCompleted != nil, "is_completed", "must be provided")
+		v.Check(input.Recurrence != nil, "recurrence", "must be provided")
+
+		todo.DueDate = nil
+		todo.ProjectID = nil
+
+		if input.Tags == nil {
+			input.Tags = []string{}
+		}
+	}
+
 	if input.Title != nil {
-		todo.Title = *input.Title
+		todo.Title = strings.TrimSpace(*input.Title)
 	}
 
 	if input.Description != nil {
@@ -163,25 +908,116 @@ func (app *application) updateTodoHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if input.DueDate != nil {
-		todo.DueDate = *input.DueDate
+		todo.DueDate = input.DueDate
 	}
 
+	wasCompleted := todo.IsCompleted
+
 	if input.IsCompleted != nil {
 		todo.IsCompleted = *input.IsCompleted
 	}
 
-	v := validator.New()
+	if input.Recurrence != nil {
+		todo.Recurrence = *input.Recurrence
+	}
+
+	// A project_id of 0 takes the todo out of its project.
+	if input.ProjectID != nil {
+		todo.ProjectID = input.ProjectID
+		if *input.ProjectID == 0 {
+			todo.ProjectID = nil
+		}
+	}
 
-	if data.ValidateTodo(v, todo); !v.Valid() {
+	data.ValidateTodo(v, todo, app.todoValidationOptions(input.DueDate == nil))
+
+	if input.Tags != nil {
+		data.ValidateTags(v, input.Tags)
+	}
+
+	if input.ProjectID != nil {
+		err = app.checkProject(r.Context(), v, user.Id, todo.ProjectID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if app.config.todos.requireSubtasksComplete && !wasCompleted && todo.IsCompleted {
+		for _, subtask := range todo.Subtasks {
+			v.Check(subtask.IsCompleted, "is_completed", "all subtasks must be completed first")
+		}
+	}
+
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Todos.Update(user.Id, todo)
+	var next *data.Todo
+
+	err = app.models.WithTx(r.Context(), func(m data.Models) error {
+		// Reopening a completed todo makes it count towards the quota again.
+		if wasCompleted && !todo.IsCompleted {
+			err := app.checkTodoQuota(r.Context(), m, user.Id, 1)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := m.Todos.Update(r.Context(), user.Id, todo)
+		if err != nil {
+			return err
+		}
+
+		// The tags are changed in the same transaction so a failure can't
+		// leave the todo updated with its old tags.
+		if input.Tags != nil {
+			var removedTags []string
+			for _, tag := range todo.Tags {
+				if !slices.Contains(input.Tags, tag) {
+					removedTags = append(removedTags, tag)
+				}
+			}
+
+			err = m.Todos.RemoveTags(r.Context(), todo.ID, user.Id, removedTags)
+			if err != nil {
+				return err
+			}
+
+			err = m.Todos.AddTags(r.Context(), todo.ID, user.Id, input.Tags)
+			if err != nil {
+				return err
+			}
+
+			todo.Tags = input.Tags
+		}
+
+		// Completing a recurring todo creates its next occurrence, as part of
+		// the completion so one can't happen without the other. It's an
+		// active todo like any other and subject to the quota.
+		if !wasCompleted && todo.IsCompleted && todo.Recurrence != data.RecurrenceNone {
+			err = app.checkTodoQuota(r.Context(), m, user.Id, 1)
+			if err != nil {
+				return err
+			}
+
+			next, err = m.Todos.InsertNextOccurrence(r.Context(), user.Id, todo)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrCheckViolation), errors.Is(err, data.ErrForeignKeyViolation):
+			app.constraintViolationResponse(w, r, err)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -189,7 +1025,19 @@ func (app *application) updateTodoHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	app.audit(r, &user.Id, data.AuditTodoUpdate, "todo", &todo.ID)
+	app.events.publish(user.Id, todoEvent{Type: todoEventUpdated, TodoID: todo.ID, Todo: todo})
+
+	env := envelope{"todo": todo}
+
+	if next != nil {
+		env["next_todo"] = next
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", todoETag(todo))
+
+	err = app.writeJSON(w, r, http.StatusOK, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,1777 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type todoResponse struct {
+	Todo struct {
+		ID int64 `json:"id"`
+	} `json:"todo"`
+}
+
+func createTodo(t *testing.T, app *application, token string, title string) (int, int64) {
+	t.Helper()
+
+	var response todoResponse
+
+	status := do(t, app, http.MethodPost, "/v1/todos", token, map[string]any{"title": title}, &response)
+
+	return status, response.Todo.ID
+}
+
+func TestTodoQuota(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.todos.maxPerUser = 2
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var ids []int64
+
+	for i := range 2 {
+		status, id := createTodo(t, app, token, fmt.Sprintf("Todo %d", i))
+		if status != http.StatusCreated {
+			t.Fatalf("todo %d of 2: got status %d; want %d", i+1, status, http.StatusCreated)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if status, _ := createTodo(t, app, token, "One too many"); status != http.StatusForbidden {
+		t.Errorf("over the quota: got status %d; want %d", status, http.StatusForbidden)
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/todos/bulk", token, []map[string]any{{"title": "Bulk"}}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("bulk over the quota: got status %d; want %d", status, http.StatusForbidden)
+	}
+
+	status = do(t, app, http.MethodPost, fmt.Sprintf("/v1/todos/%d/duplicate", ids[0]), token, nil, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("duplicate over the quota: got status %d; want %d", status, http.StatusForbidden)
+	}
+
+	// Completed todos don't count.
+	status = do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", ids[0]), token, map[string]any{"is_completed": true}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("completing a todo: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if status, _ := createTodo(t, app, token, "Replacement"); status != http.StatusCreated {
+		t.Errorf("after completing a todo: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	status = do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", ids[0]), token, map[string]any{"is_completed": false}, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("reopening over the quota: got status %d; want %d", status, http.StatusForbidden)
+	}
+
+	status = do(t, app, http.MethodPost, "/v1/todos/uncomplete-all", token, nil, nil)
+	if status != http.StatusForbidden {
+		t.Errorf("reopening all over the quota: got status %d; want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestCompleteAllTodos(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	_, done := createTodo(t, app, alice, "Already done")
+
+	status := do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", done), alice, map[string]any{"is_completed": true}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("completing a todo: got status %d; want %d", status, http.StatusOK)
+	}
+
+	for _, title := range []string{"Buy milk", "Walk the dog"} {
+		createTodo(t, app, alice, title)
+	}
+
+	createTodo(t, app, bob, "Bob's todo")
+
+	stats := func(token string) data.TodoStats {
+		t.Helper()
+
+		var response struct {
+			Stats data.TodoStats `json:"stats"`
+		}
+
+		if status := do(t, app, http.MethodGet, "/v1/todos/stats", token, nil, &response); status != http.StatusOK {
+			t.Fatalf("stats: got status %d; want %d", status, http.StatusOK)
+		}
+
+		return response.Stats
+	}
+
+	tests := []struct {
+		path          string
+		wantUpdated   int
+		wantCompleted int
+	}{
+		{"/v1/todos/complete-all", 2, 3},
+		{"/v1/todos/complete-all", 0, 3},
+		{"/v1/todos/uncomplete-all", 3, 0},
+	}
+
+	for _, tt := range tests {
+		var response struct {
+			Updated int `json:"updated"`
+		}
+
+		status := do(t, app, http.MethodPost, tt.path, alice, nil, &response)
+		if status != http.StatusOK {
+			t.Fatalf("%s: got status %d; want %d", tt.path, status, http.StatusOK)
+		}
+
+		if response.Updated != tt.wantUpdated {
+			t.Errorf("%s: got %d updated; want %d", tt.path, response.Updated, tt.wantUpdated)
+		}
+
+		if got := stats(alice); got.Completed != tt.wantCompleted || got.Total != 3 {
+			t.Errorf("%s: got stats %+v; want %d of 3 completed", tt.path, got, tt.wantCompleted)
+		}
+
+		if got := stats(bob); got.Completed != 0 || got.Total != 1 {
+			t.Errorf("%s: got bob's stats %+v; want it untouched", tt.path, got)
+		}
+	}
+}
+
+func TestTodoQuotaConcurrent(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.todos.maxPerUser = 3
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		statuses = map[int]int{}
+	)
+
+	for i := range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			status, _ := createTodo(t, app, token, fmt.Sprintf("Todo %d", i))
+
+			mu.Lock()
+			statuses[status]++
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if statuses[http.StatusCreated] != 3 || statuses[http.StatusForbidden] != 7 {
+		t.Errorf("got statuses %v; want 3 created and 7 forbidden", statuses)
+	}
+}
+
+func TestReplaceAndUpdateTodo(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	_, id := createTodo(t, app, token, "Buy milk")
+
+	path := fmt.Sprintf("/v1/todos/%d", id)
+	body := map[string]any{"title": "Buy oat milk", "tags": []string{"groceries"}}
+
+	if status := do(t, app, http.MethodPut, path, token, body, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("PUT without every field: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	var response struct {
+		Todo struct {
+			Title string   `json:"title"`
+			Tags  []string `json:"tags"`
+		} `json:"todo"`
+	}
+
+	if status := do(t, app, http.MethodPatch, path, token, body, &response); status != http.StatusOK {
+		t.Fatalf("PATCH: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if response.Todo.Title != "Buy oat milk" || len(response.Todo.Tags) != 1 || response.Todo.Tags[0] != "groceries" {
+		t.Errorf("got todo %+v; want the new title and tags", response.Todo)
+	}
+
+	body = map[string]any{"title": "Buy milk", "description": "", "is_completed": false, "recurrence": "none"}
+
+	if status := do(t, app, http.MethodPut, path, token, body, &response); status != http.StatusOK {
+		t.Fatalf("PUT: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if response.Todo.Title != "Buy milk" || len(response.Todo.Tags) != 0 {
+		t.Errorf("got todo %+v; want the tags cleared by the full replacement", response.Todo)
+	}
+}
+
+func TestCompleteRecurringTodo(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	dueDate := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		recurrence string
+		next       bool
+	}{
+		{"weekly", true},
+		{"none", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.recurrence, func(t *testing.T) {
+			var created todoResponse
+
+			body := map[string]any{"title": "Water the plants", "due_date": dueDate, "recurrence": tt.recurrence}
+
+			if status := do(t, app, http.MethodPost, "/v1/todos", token, body, &created); status != http.StatusCreated {
+				t.Fatalf("creating the todo: got status %d; want %d", status, http.StatusCreated)
+			}
+
+			var response struct {
+				NextTodo *struct {
+					DueDate    time.Time `json:"due_date"`
+					Recurrence string    `json:"recurrence"`
+				} `json:"next_todo"`
+			}
+
+			status := do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", created.Todo.ID), token, map[string]any{"is_completed": true}, &response)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d; want %d", status, http.StatusOK)
+			}
+
+			if !tt.next {
+				if response.NextTodo != nil {
+					t.Errorf("got next todo %+v; want none", response.NextTodo)
+				}
+
+				return
+			}
+
+			if response.NextTodo == nil {
+				t.Fatal("no next todo was created")
+			}
+
+			if want := dueDate.AddDate(0, 0, 7); !response.NextTodo.DueDate.Equal(want) {
+				t.Errorf("got due date %s; want %s", response.NextTodo.DueDate, want)
+			}
+
+			if response.NextTodo.Recurrence != tt.recurrence {
+				t.Errorf("got recurrence %q; want %q", response.NextTodo.Recurrence, tt.recurrence)
+			}
+		})
+	}
+}
+
+func TestCompleteRecurringTodoOverQuota(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var ids []int64
+
+	for i := range 2 {
+		var created todoResponse
+
+		body := map[string]any{"title": fmt.Sprintf("Todo %d", i), "recurrence": "daily"}
+
+		if status := do(t, app, http.MethodPost, "/v1/todos", token, body, &created); status != http.StatusCreated {
+			t.Fatalf("creating todo %d: got status %d; want %d", i, status, http.StatusCreated)
+		}
+
+		ids = append(ids, created.Todo.ID)
+	}
+
+	// Lowering the quota below what the user has leaves no room for the next
+	// occurrence, so the completion is rolled back with it.
+	app.config.todos.maxPerUser = 1
+
+	path := fmt.Sprintf("/v1/todos/%d", ids[0])
+
+	if status := do(t, app, http.MethodPatch, path, token, map[string]any{"is_completed": true}, nil); status != http.StatusForbidden {
+		t.Fatalf("got status %d; want %d", status, http.StatusForbidden)
+	}
+
+	var response struct {
+		Todo struct {
+			IsCompleted bool `json:"is_completed"`
+		} `json:"todo"`
+	}
+
+	do(t, app, http.MethodGet, path, token, nil, &response)
+
+	if response.Todo.IsCompleted {
+		t.Error("the todo was completed without its next occurrence")
+	}
+}
+
+func TestListTodosMetadata(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	createTodo(t, app, token, "Buy milk")
+
+	var response map[string]json.RawMessage
+
+	if status := do(t, app, http.MethodGet, "/v1/todos", token, nil, &response); status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	var metadata struct {
+		TotalRecords int `json:"total_records"`
+	}
+
+	err := json.Unmarshal(response["metadata"], &metadata)
+	if err != nil {
+		t.Fatalf("response has no metadata: %v", err)
+	}
+
+	if metadata.TotalRecords != 1 {
+		t.Errorf("got %d total records; want 1", metadata.TotalRecords)
+	}
+}
+
+func TestCreateTodosBulk(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var response struct {
+		Todos []struct {
+			ID    int64  `json:"id"`
+			Title string `json:"title"`
+		} `json:"todos"`
+	}
+
+	body := []map[string]any{{"title": "Buy milk"}, {"title": "Walk the dog", "is_completed": true}}
+
+	if status := do(t, app, http.MethodPost, "/v1/todos/bulk", token, body, &response); status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if len(response.Todos) != 2 {
+		t.Fatalf("got %d todos; want 2", len(response.Todos))
+	}
+
+	for i, todo := range response.Todos {
+		if todo.ID == 0 || todo.Title != body[i]["title"] {
+			t.Errorf("todo %d: got %+v; want it created with title %q", i, todo, body[i]["title"])
+		}
+	}
+}
+
+func TestCreateTodosBulkValidation(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{Id: 1}
+
+	var response struct {
+		Error map[string]json.RawMessage `json:"error"`
+	}
+
+	status := doAs(t, app, app.createTodosBulkHandler, user, http.MethodPost, "/v1/todos/bulk", []any{}, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("empty array: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if _, ok := response.Error["todos"]; !ok {
+		t.Errorf("empty array: got errors %v; want one for todos", response.Error)
+	}
+
+	response.Error = nil
+
+	body := []map[string]any{{"title": "Buy milk"}, {"title": ""}, {"title": "Walk the dog"}}
+
+	status = doAs(t, app, app.createTodosBulkHandler, user, http.MethodPost, "/v1/todos/bulk", body, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("one invalid item: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if len(response.Error) != 1 || response.Error["1"] == nil {
+		t.Errorf("one invalid item: got errors %v; want only item 1's", response.Error)
+	}
+}
+
+func TestDeleteTodosBulk(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	aliceUser := insertTestUser(t, app, "alice@example.com")
+	alice := authenticate(t, app, aliceUser)
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	_, aliceTodo := createTodo(t, app, alice, "Alice's todo")
+	_, bobTodo := createTodo(t, app, bob, "Bob's todo")
+
+	events, unsubscribe := app.events.subscribe(aliceUser.Id)
+	defer unsubscribe()
+
+	var response struct {
+		Deleted int64 `json:"deleted"`
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/todos/bulk-delete", alice, map[string]any{"ids": []int64{aliceTodo, bobTodo, bobTodo + 1000}}, &response)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if response.Deleted != 1 {
+		t.Errorf("got %d deleted; want 1, only the todo alice owns", response.Deleted)
+	}
+
+	// Only the todo that was deleted is announced.
+	if len(events) != 1 {
+		t.Fatalf("got %d events; want 1", len(events))
+	}
+
+	if event := <-events; event.Type != todoEventDeleted || event.TodoID != aliceTodo {
+		t.Errorf("got event %+v; want todo %d deleted", event, aliceTodo)
+	}
+
+	if status := do(t, app, http.MethodGet, fmt.Sprintf("/v1/todos/%d", aliceTodo), alice, nil, nil); status != http.StatusNotFound {
+		t.Errorf("alice's todo: got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	if status := do(t, app, http.MethodGet, fmt.Sprintf("/v1/todos/%d", bobTodo), bob, nil, nil); status != http.StatusOK {
+		t.Errorf("bob's todo: got status %d; want %d", status, http.StatusOK)
+	}
+}
+
+type todoList struct {
+	Todos []struct {
+		ID    int64    `json:"id"`
+		Title string   `json:"title"`
+		Tags  []string `json:"tags"`
+	} `json:"todos"`
+}
+
+func (l todoList) titles() []string {
+	titles := []string{}
+
+	for _, todo := range l.Todos {
+		titles = append(titles, todo.Title)
+	}
+
+	return titles
+}
+
+func listTodos(t *testing.T, app *application, token string, query string) todoList {
+	t.Helper()
+
+	var list todoList
+
+	if status := do(t, app, http.MethodGet, "/v1/todos?"+query, token, nil, &list); status != http.StatusOK {
+		t.Fatalf("listing todos with %q: got status %d; want %d", query, status, http.StatusOK)
+	}
+
+	return list
+}
+
+func TestTodoTags(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	for _, todo := range []map[string]any{
+		{"title": "Write report", "tags": []string{"work", "urgent"}},
+		{"title": "Book flights", "tags": []string{"work"}},
+		{"title": "Water plants"},
+	} {
+		if status := do(t, app, http.MethodPost, "/v1/todos", token, todo, nil); status != http.StatusCreated {
+			t.Fatalf("creating %v: got status %d; want %d", todo["title"], status, http.StatusCreated)
+		}
+	}
+
+	list := listTodos(t, app, token, "sort=title&order=asc")
+
+	if len(list.Todos) != 3 || !slices.Equal(list.Todos[2].Tags, []string{"urgent", "work"}) {
+		t.Errorf("got todos %+v; want the report's tags attached", list.Todos)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"tag=work", []string{"Book flights", "Write report"}},
+		{"tag=work&tag=urgent", []string{"Write report"}},
+		{"tag=home", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := listTodos(t, app, token, tt.query+"&sort=title&order=asc").titles(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/todos", token, map[string]any{"title": "Untagged", "tags": []string{""}}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("empty tag: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestTodoTagsCaseInsensitive(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	status := do(t, app, http.MethodPost, "/v1/todos", token, map[string]any{"title": "Write report", "tags": []string{"Work", "work", " WORK "}}, nil)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	list := listTodos(t, app, token, "")
+
+	if len(list.Todos) != 1 || !slices.Equal(list.Todos[0].Tags, []string{"work"}) {
+		t.Errorf("got todos %+v; want a single work tag", list.Todos)
+	}
+
+	for _, tag := range []string{"work", "Work", "WORK"} {
+		if got := listTodos(t, app, token, "tag="+tag).titles(); !slices.Equal(got, []string{"Write report"}) {
+			t.Errorf("tag=%s: got %v; want [Write report]", tag, got)
+		}
+	}
+}
+
+func TestListTodosCursorPagination(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var created []int64
+
+	for i := range 5 {
+		_, id := createTodo(t, app, token, fmt.Sprintf("Todo %d", i))
+		created = append(created, id)
+	}
+
+	var (
+		seen   []int64
+		cursor int64
+	)
+
+	for page := 1; ; page++ {
+		var response struct {
+			Todos []struct {
+				ID int64 `json:"id"`
+			} `json:"todos"`
+			Metadata struct {
+				NextCursor int64 `json:"next_cursor"`
+			} `json:"metadata"`
+		}
+
+		path := fmt.Sprintf("/v1/todos?page_size=2&after_id=%d", cursor)
+
+		if status := do(t, app, http.MethodGet, path, token, nil, &response); status != http.StatusOK {
+			t.Fatalf("page %d: got status %d; want %d", page, status, http.StatusOK)
+		}
+
+		for _, todo := range response.Todos {
+			seen = append(seen, todo.ID)
+		}
+
+		if response.Metadata.NextCursor == 0 {
+			break
+		}
+
+		if page > 5 {
+			t.Fatal("pagination didn't end")
+		}
+
+		cursor = response.Metadata.NextCursor
+	}
+
+	if !slices.Equal(seen, created) {
+		t.Errorf("got ids %v across pages; want each of %v once, in order", seen, created)
+	}
+}
+
+func TestCreateTodoCreatedAt(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var response struct {
+		Todo struct {
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"todo"`
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/todos", token, map[string]any{"title": "Buy milk"}, &response)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if response.Todo.CreatedAt.IsZero() {
+		t.Errorf("got zero created_at; want the creation time")
+	}
+}
+
+func TestListTodosCreatedRange(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	for title, createdAt := range map[string]string{
+		"January":  "2024-01-01T12:00:00Z",
+		"February": "2024-02-01T12:00:00Z",
+		"March":    "2024-03-01T12:00:00Z",
+	} {
+		_, id := createTodo(t, app, token, title)
+
+		_, err := app.db.Exec(context.Background(), "UPDATE todos SET created_at = $1 WHERE id = $2", createdAt, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"created after", "created_after=2024-02-01T12:00:00Z", []string{"February", "March"}},
+		{"created before", "created_before=2024-02-01T12:00:00Z", []string{"February", "January"}},
+		{"created between", "created_after=2024-01-15T00:00:00Z&created_before=2024-02-15T00:00:00Z", []string{"February"}},
+		{"empty range", "created_after=2024-03-02T00:00:00Z&created_before=2024-03-02T00:00:00Z", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listTodos(t, app, token, tt.query+"&sort=title&order=asc").titles(); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListTodosCreatedRangeInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"before after", "created_after=2024-02-01T00:00:00Z&created_before=2024-01-01T00:00:00Z", "created_before"},
+		{"malformed", "created_after=yesterday", "created_after"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			var response struct {
+				Error map[string]string `json:"error"`
+			}
+
+			status := doAs(t, app, app.listTodosHandler, &data.User{Id: 1}, http.MethodGet, "/v1/todos?"+tt.query, nil, &response)
+			if status != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+			}
+
+			if response.Error[tt.field] == "" {
+				t.Errorf("got errors %v; want one for %s", response.Error, tt.field)
+			}
+		})
+	}
+}
+
+func TestListTodosSmartSort(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, todo := range []struct {
+		title     string
+		due       time.Duration
+		completed bool
+	}{
+		{"Done later", 3 * time.Hour, true},
+		{"Pending later", 2 * time.Hour, false},
+		{"Done soon", time.Hour, true},
+		{"Pending soon", time.Hour, false},
+	} {
+		body := map[string]any{"title": todo.title, "due_date": now.Add(todo.due), "is_completed": todo.completed}
+
+		if status := do(t, app, http.MethodPost, "/v1/todos", token, body, nil); status != http.StatusCreated {
+			t.Fatalf("creating %q: got status %d; want %d", todo.title, status, http.StatusCreated)
+		}
+	}
+
+	want := []string{"Pending soon", "Pending later", "Done soon", "Done later"}
+
+	// Pending todos come first whichever direction is asked for.
+	for _, order := range []string{"asc", "desc"} {
+		if got := listTodos(t, app, token, "sort=smart&order="+order).titles(); !slices.Equal(got, want) {
+			t.Errorf("order=%s: got %v; want %v", order, got, want)
+		}
+	}
+}
+
+func TestTodoStats(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	stats := func() data.TodoStats {
+		t.Helper()
+
+		var response struct {
+			Stats data.TodoStats `json:"stats"`
+		}
+
+		status := do(t, app, http.MethodGet, "/v1/todos/stats", token, nil, &response)
+		if status != http.StatusOK {
+			t.Fatalf("got status %d; want %d", status, http.StatusOK)
+		}
+
+		return response.Stats
+	}
+
+	if got := stats(); got != (data.TodoStats{}) {
+		t.Errorf("no todos: got %+v; want all zero", got)
+	}
+
+	var ids []int64
+
+	for i := range 3 {
+		status, id := createTodo(t, app, token, fmt.Sprintf("Todo %d", i))
+		if status != http.StatusCreated {
+			t.Fatalf("creating todo %d: got status %d; want %d", i, status, http.StatusCreated)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if got, want := stats(), (data.TodoStats{Total: 3, Pending: 3}); got != want {
+		t.Errorf("after creating: got %+v; want %+v", got, want)
+	}
+
+	status := do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", ids[0]), token, map[string]any{"is_completed": true}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("completing a todo: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if got, want := stats(), (data.TodoStats{Total: 3, Completed: 1, Pending: 2}); got != want {
+		t.Errorf("after completing: got %+v; want %+v", got, want)
+	}
+
+	// Let the completed todo and one pending todo lapse; only the pending one is
+	// overdue.
+	_, err := app.db.Exec(context.Background(), "UPDATE todos SET due_date = NOW() - INTERVAL '1 hour' WHERE id = ANY($1)", ids[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stats(), (data.TodoStats{Total: 3, Completed: 1, Pending: 2, Overdue: 1}); got != want {
+		t.Errorf("after lapsing: got %+v; want %+v", got, want)
+	}
+}
+
+func TestListTodosRelevance(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	// Title matches outrank description matches. The stronger match is created
+	// first, so ordering by creation alone would put it last.
+	todos := []map[string]any{
+		{"title": "Buy milk"},
+		{"title": "Groceries", "description": "Remember the milk"},
+		{"title": "Walk the dog"},
+	}
+
+	for _, todo := range todos {
+		if status := do(t, app, http.MethodPost, "/v1/todos", token, todo, nil); status != http.StatusCreated {
+			t.Fatalf("creating %v: got status %d; want %d", todo, status, http.StatusCreated)
+		}
+	}
+
+	got := listTodos(t, app, token, "search=milk&sort=relevance").titles()
+	want := []string{"Buy milk", "Groceries"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	// Without a search term relevance falls back to the creation order.
+	if got := listTodos(t, app, token, "sort=relevance").titles(); len(got) != 3 {
+		t.Errorf("without a search term: got %v; want all 3 todos", got)
+	}
+}
+
+func TestListTodosSearchWeights(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	// The description mentions the term more often, but a single title match
+	// still ranks higher.
+	_, descriptionID := createTodo(t, app, token, "Groceries")
+
+	status := do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", descriptionID), token, map[string]any{"description": "milk, more milk and oat milk"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("setting the description: got status %d; want %d", status, http.StatusOK)
+	}
+
+	_, titleID := createTodo(t, app, token, "Pick up bread")
+
+	// The search vector is generated from the columns, so it follows updates.
+	status = do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", titleID), token, map[string]any{"title": "Buy milk"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("renaming the todo: got status %d; want %d", status, http.StatusOK)
+	}
+
+	got := listTodos(t, app, token, "search=milk&sort=relevance").titles()
+	want := []string{"Buy milk", "Groceries"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if got := listTodos(t, app, token, "search=bread").titles(); len(got) != 0 {
+		t.Errorf("searching the old title: got %v; want no todos", got)
+	}
+}
+
+func TestListTodosSearchTooLong(t *testing.T) {
+	app := newTestApplication(t)
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+
+	path := "/v1/todos?search=" + strings.Repeat("a", data.MaxSearchLength+1)
+
+	status := doAs(t, app, app.listTodosHandler, &data.User{Id: 1}, http.MethodGet, path, nil, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if response.Error["search"] == "" {
+		t.Errorf("got errors %v; want one for search", response.Error)
+	}
+}
+
+func TestListTodosSearchTrimmed(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	for _, title := range []string{"Buy milk", "Walk the dog"} {
+		createTodo(t, app, token, title)
+	}
+
+	// The padding would push the term over the limit if it weren't trimmed.
+	search := url.QueryEscape(strings.Repeat(" ", data.MaxSearchLength) + "milk ")
+
+	if got := listTodos(t, app, token, "search="+search).titles(); !slices.Equal(got, []string{"Buy milk"}) {
+		t.Errorf("got %v; want [Buy milk]", got)
+	}
+}
+
+func TestSuggestTodos(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	for _, title := range []string{"Buy milk", "Buy bread", "Walk the dog"} {
+		if status, _ := createTodo(t, app, token, title); status != http.StatusCreated {
+			t.Fatalf("creating %q: got status %d; want %d", title, status, http.StatusCreated)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    string
+		want []string
+	}{
+		{"matching prefix", "bu", []string{"Buy bread", "Buy milk"}},
+		{"no match", "xyz", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response struct {
+				Suggestions []string `json:"suggestions"`
+			}
+
+			status := do(t, app, http.MethodGet, "/v1/todos/suggest?q="+tt.q, token, nil, &response)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d; want %d", status, http.StatusOK)
+			}
+
+			if response.Suggestions == nil || !slices.Equal(response.Suggestions, tt.want) {
+				t.Errorf("got %v; want %v", response.Suggestions, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestTodosQueryTooShort(t *testing.T) {
+	app := newTestApplication(t)
+
+	status := doAs(t, app, app.suggestTodosHandler, &data.User{Id: 1}, http.MethodGet, "/v1/todos/suggest?q=b", nil, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestCreateTodoDueDate(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	dueDate := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name string
+		body map[string]any
+		want *time.Time
+	}{
+		{"without a due date", map[string]any{"title": "Someday"}, nil},
+		{"with a due date", map[string]any{"title": "Tomorrow", "due_date": dueDate}, &dueDate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response struct {
+				Todo map[string]any `json:"todo"`
+			}
+
+			status := do(t, app, http.MethodPost, "/v1/todos", token, tt.body, &response)
+			if status != http.StatusCreated {
+				t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+			}
+
+			_, ok := response.Todo["due_date"]
+			if ok != (tt.want != nil) {
+				t.Errorf("got due_date in the response %t; want %t", ok, tt.want != nil)
+			}
+
+			var stored *time.Time
+
+			err := app.db.QueryRow(context.Background(), "SELECT due_date FROM todos WHERE id = $1", int64(response.Todo["id"].(float64))).Scan(&stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case tt.want == nil && stored != nil:
+				t.Errorf("got stored due_date %v; want NULL", stored)
+			case tt.want != nil && (stored == nil || !stored.Equal(*tt.want)):
+				t.Errorf("got stored due_date %v; want %v", stored, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTodoIdempotencyKey(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	user := insertTestUser(t, app, "alice@example.com")
+	token := authenticate(t, app, user)
+
+	create := func(title string) (int, map[string]any) {
+		t.Helper()
+
+		req := newRequest(t, http.MethodPost, "/v1/todos", map[string]any{"title": title})
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", "create-buy-milk")
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		var response struct {
+			Todo map[string]any `json:"todo"`
+		}
+
+		decode(t, rr, &response)
+
+		return rr.Code, response.Todo
+	}
+
+	firstStatus, first := create("Buy milk")
+	if firstStatus != http.StatusCreated {
+		t.Fatalf("first request: got status %d; want %d", firstStatus, http.StatusCreated)
+	}
+
+	// The retry's body is ignored in favour of the original todo.
+	secondStatus, second := create("Buy milk again")
+	if secondStatus != firstStatus {
+		t.Errorf("retry: got status %d; want %d", secondStatus, firstStatus)
+	}
+
+	for _, field := range []string{"id", "title", "created_at"} {
+		if second[field] != first[field] {
+			t.Errorf("retry: got %s %v; want %v", field, second[field], first[field])
+		}
+	}
+
+	var count int
+
+	err := app.db.QueryRow(context.Background(), "SELECT count(*) FROM todos WHERE user_id = $1", user.Id).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Errorf("got %d todos; want 1", count)
+	}
+}
+
+func TestCreateTodoIdempotencyKeyConcurrent(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	user := insertTestUser(t, app, "alice@example.com")
+	token := authenticate(t, app, user)
+
+	const n = 5
+
+	reqs := make([]*http.Request, n)
+	for i := range reqs {
+		reqs[i] = newRequest(t, http.MethodPost, "/v1/todos", map[string]any{"title": "Buy milk"})
+		reqs[i].Header.Set("Authorization", "Bearer "+token)
+		reqs[i].Header.Set("Idempotency-Key", "create-buy-milk")
+	}
+
+	routes := app.routes()
+	recorders := make([]*httptest.ResponseRecorder, n)
+
+	var wg sync.WaitGroup
+
+	for i, req := range reqs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			recorders[i] = httptest.NewRecorder()
+			routes.ServeHTTP(recorders[i], req)
+		}()
+	}
+
+	wg.Wait()
+
+	ids := map[int64]bool{}
+
+	for _, rr := range recorders {
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("got status %d; want %d", rr.Code, http.StatusCreated)
+		}
+
+		var response todoResponse
+		decode(t, rr, &response)
+
+		ids[response.Todo.ID] = true
+	}
+
+	if len(ids) != 1 {
+		t.Errorf("got todos %v; want every request to get the same one", ids)
+	}
+
+	var count int
+
+	err := app.db.QueryRow(context.Background(), "SELECT count(*) FROM todos WHERE user_id = $1", user.Id).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Errorf("got %d todos; want 1", count)
+	}
+}
+
+func TestTodoConditionalRequests(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	_, id := createTodo(t, app, token, "Buy milk")
+	path := fmt.Sprintf("/v1/todos/%d", id)
+
+	send := func(method, header, etag string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := newRequest(t, method, path, body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if etag != "" {
+			req.Header.Set(header, etag)
+		}
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := send(http.MethodGet, "", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("got no ETag")
+	}
+
+	if rr := send(http.MethodGet, "If-None-Match", etag, nil); rr.Code != http.StatusNotModified {
+		t.Errorf("unchanged: got status %d; want %d", rr.Code, http.StatusNotModified)
+	}
+
+	status := do(t, app, http.MethodPatch, path, token, map[string]any{"title": "Buy oat milk"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("updating: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if rr := send(http.MethodGet, "If-None-Match", etag, nil); rr.Code != http.StatusOK {
+		t.Errorf("changed: got status %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	if rr := send(http.MethodPut, "If-Match", etag, map[string]any{"title": "Buy bread"}); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: got status %d; want %d", rr.Code, http.StatusPreconditionFailed)
+	}
+}
+
+func TestDueSoonTodos(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	now := time.Now()
+
+	todos := []struct {
+		title     string
+		dueIn     time.Duration
+		completed bool
+	}{
+		{"Later", 48 * time.Hour, false},
+		{"Soon", 2 * time.Hour, false},
+		{"Sooner", time.Hour, false},
+		{"Done", 3 * time.Hour, true},
+	}
+
+	for _, todo := range todos {
+		var response todoResponse
+
+		body := map[string]any{"title": todo.title, "due_date": now.Add(todo.dueIn)}
+
+		if status := do(t, app, http.MethodPost, "/v1/todos", token, body, &response); status != http.StatusCreated {
+			t.Fatalf("creating %q: got status %d; want %d", todo.title, status, http.StatusCreated)
+		}
+
+		if todo.completed {
+			path := fmt.Sprintf("/v1/todos/%d", response.Todo.ID)
+
+			if status := do(t, app, http.MethodPatch, path, token, map[string]any{"is_completed": true}, nil); status != http.StatusOK {
+				t.Fatalf("completing %q: got status %d; want %d", todo.title, status, http.StatusOK)
+			}
+		}
+	}
+
+	if status, _ := createTodo(t, app, token, "Someday"); status != http.StatusCreated {
+		t.Fatalf("creating a todo without a due date: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	var list todoList
+
+	if status := do(t, app, http.MethodGet, "/v1/todos/due-soon?within=24h", token, nil, &list); status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if got, want := list.titles(), []string{"Sooner", "Soon"}; !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestDueSoonTodosInvalidWithin(t *testing.T) {
+	app := newTestApplication(t)
+
+	for _, within := range []string{"tomorrow", "-1h", "0s"} {
+		status := doAs(t, app, app.dueSoonTodosHandler, &data.User{Id: 1}, http.MethodGet, "/v1/todos/due-soon?within="+within, nil, nil)
+		if status != http.StatusUnprocessableEntity {
+			t.Errorf("within=%s: got status %d; want %d", within, status, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestReorderTodos(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	ids := map[string]int64{}
+
+	for _, title := range []string{"A", "B", "C"} {
+		_, ids[title] = createTodo(t, app, alice, title)
+	}
+
+	_, ids["X"] = createTodo(t, app, bob, "X")
+
+	status := do(t, app, http.MethodPost, "/v1/todos/reorder", alice, map[string]any{"ids": []int64{ids["C"], ids["X"], ids["A"], ids["B"]}}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("reordering: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if got, want := listTodos(t, app, alice, "sort=position&order=asc").titles(), []string{"C", "A", "B"}; !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	// Ids of another user's todos are ignored, in either direction.
+	status = do(t, app, http.MethodPost, "/v1/todos/reorder", bob, map[string]any{"ids": []int64{ids["B"], ids["A"], ids["X"]}}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("reordering as another user: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if got, want := listTodos(t, app, alice, "sort=position&order=asc").titles(), []string{"C", "A", "B"}; !slices.Equal(got, want) {
+		t.Errorf("after another user's reorder: got %v; want %v", got, want)
+	}
+
+	if got, want := listTodos(t, app, bob, "sort=position&order=asc").titles(), []string{"X"}; !slices.Equal(got, want) {
+		t.Errorf("other user's todos: got %v; want %v", got, want)
+	}
+}
+
+func TestCreateTodoDescriptionTooLong(t *testing.T) {
+	app := newTestApplication(t)
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+
+	body := map[string]any{"title": "Buy milk", "description": strings.Repeat("a", data.MaxDescriptionLength+1)}
+
+	status := doAs(t, app, app.createTodoHandler, &data.User{Id: 1}, http.MethodPost, "/v1/todos", body, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if response.Error["description"] == "" {
+		t.Errorf("got errors %v; want one for description", response.Error)
+	}
+}
+
+func TestListTodosByIDs(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	ids := map[string]int64{}
+
+	for _, title := range []string{"A", "B", "C"} {
+		_, ids[title] = createTodo(t, app, alice, title)
+	}
+
+	_, ids["X"] = createTodo(t, app, bob, "X")
+
+	query := fmt.Sprintf("ids=%d,%d,%d", ids["C"], ids["X"], ids["A"])
+
+	if got, want := listTodos(t, app, alice, query).titles(), []string{"C", "A"}; !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestListTodosByIDsCap(t *testing.T) {
+	app := newTestApplication(t)
+
+	ids := make([]string, 101)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+
+	path := "/v1/todos?ids=" + strings.Join(ids, ",")
+
+	status := doAs(t, app, app.listTodosHandler, &data.User{Id: 1}, http.MethodGet, path, nil, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestCreateTodoValidationErrors(t *testing.T) {
+	app := newTestApplication(t)
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+
+	body := map[string]any{"title": "", "description": strings.Repeat("a", data.MaxDescriptionLength+1)}
+
+	status := doAs(t, app, app.createTodoHandler, &data.User{Id: 1}, http.MethodPost, "/v1/todos", body, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	for _, field := range []string{"title", "description"} {
+		if response.Error[field] == "" {
+			t.Errorf("got errors %v; want one for %s", response.Error, field)
+		}
+	}
+}
+
+func TestCreateTodoConfiguredTitleLength(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.todos.maxTitleLength = 10
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+
+	status := doAs(t, app, app.createTodoHandler, &data.User{Id: 1}, http.MethodPost, "/v1/todos", map[string]any{"title": "Buy milk and bread"}, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if want := "must not be more than 10 characters long"; response.Error["title"] != want {
+		t.Errorf("got error %q; want %q", response.Error["title"], want)
+	}
+}
+
+func TestDeleteTodoReturning(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	_, id := createTodo(t, app, token, "Buy milk")
+
+	status := do(t, app, http.MethodPatch, fmt.Sprintf("/v1/todos/%d", id), token, map[string]any{"description": "Semi-skimmed"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("setting the description: got status %d; want %d", status, http.StatusOK)
+	}
+
+	var returned struct {
+		Message string     `json:"message"`
+		Todo    *data.Todo `json:"todo"`
+	}
+
+	status = do(t, app, http.MethodDelete, fmt.Sprintf("/v1/todos/%d?return=true", id), token, nil, &returned)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if returned.Todo == nil {
+		t.Fatal("the deleted todo wasn't returned")
+	}
+
+	if returned.Todo.ID != id || returned.Todo.Title != "Buy milk" || returned.Todo.Description != "Semi-skimmed" {
+		t.Errorf("got todo %+v; want the deleted todo", returned.Todo)
+	}
+
+	_, id = createTodo(t, app, token, "Walk the dog")
+
+	var response map[string]any
+
+	status = do(t, app, http.MethodDelete, fmt.Sprintf("/v1/todos/%d", id), token, nil, &response)
+	if status != http.StatusOK {
+		t.Fatalf("without return: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if _, ok := response["todo"]; ok || response["message"] == nil {
+		t.Errorf("without return: got %v; want just the message", response)
+	}
+}
+
+func TestShowTodoNotFound(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var response struct {
+		Error string `json:"error"`
+	}
+
+	status := do(t, app, http.MethodGet, "/v1/todos/999999", token, nil, &response)
+	if status != http.StatusNotFound {
+		t.Fatalf("got status %d; want %d", status, http.StatusNotFound)
+	}
+
+	if want := "the requested todo could not be found"; response.Error != want {
+		t.Errorf("got error %q; want %q", response.Error, want)
+	}
+}
+
+func TestTodoFields(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	_, id := createTodo(t, app, token, "Buy milk")
+
+	var list struct {
+		Todos []map[string]any `json:"todos"`
+	}
+
+	status := do(t, app, http.MethodGet, "/v1/todos?fields=id,title", token, nil, &list)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if len(list.Todos) != 1 || len(list.Todos[0]) != 2 || list.Todos[0]["title"] != "Buy milk" || list.Todos[0]["id"] == nil {
+		t.Errorf("got todos %v; want only id and title", list.Todos)
+	}
+
+	var show struct {
+		Todo map[string]any `json:"todo"`
+	}
+
+	status = do(t, app, http.MethodGet, fmt.Sprintf("/v1/todos/%d?fields=id,is_completed", id), token, nil, &show)
+	if status != http.StatusOK {
+		t.Fatalf("showing the todo: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if len(show.Todo) != 2 || show.Todo["is_completed"] != false {
+		t.Errorf("got todo %v; want only id and is_completed", show.Todo)
+	}
+}
+
+func TestTodoFieldsInvalid(t *testing.T) {
+	app := newTestApplication(t)
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+
+	status := doAs(t, app, app.listTodosHandler, &data.User{Id: 1}, http.MethodGet, "/v1/todos?fields=id,password", nil, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if response.Error["fields"] == "" {
+		t.Errorf("got errors %v; want one for fields", response.Error)
+	}
+}
+
+func TestListTodosPageOutOfRange(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	if status := do(t, app, http.MethodGet, "/v1/todos?page=1", token, nil, nil); status != http.StatusOK {
+		t.Errorf("first page without todos: got status %d; want %d", status, http.StatusOK)
+	}
+
+	for i := range 3 {
+		createTodo(t, app, token, fmt.Sprintf("Todo %d", i))
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/todos?page=2&page_size=2", token, nil, nil); status != http.StatusOK {
+		t.Errorf("last page: got status %d; want %d", status, http.StatusOK)
+	}
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+
+	status := do(t, app, http.MethodGet, "/v1/todos?page=3&page_size=2", token, nil, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("beyond the last page: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if response.Error["page"] == "" {
+		t.Errorf("beyond the last page: got errors %v; want one for page", response.Error)
+	}
+}
+
+func TestDuplicateTodo(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	alice := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	bob := authenticate(t, app, insertTestUser(t, app, "bob@example.com"))
+
+	dueDate := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	var original todoResponse
+
+	body := map[string]any{"title": "Water the plants", "description": "The ferns too", "due_date": dueDate}
+
+	if status := do(t, app, http.MethodPost, "/v1/todos", alice, body, &original); status != http.StatusCreated {
+		t.Fatalf("creating: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	path := fmt.Sprintf("/v1/todos/%d", original.Todo.ID)
+
+	if status := do(t, app, http.MethodPatch, path, alice, map[string]any{"is_completed": true}, nil); status != http.StatusOK {
+		t.Fatalf("completing: got status %d; want %d", status, http.StatusOK)
+	}
+
+	req := newRequest(t, http.MethodPost, path+"/duplicate", nil)
+	req.Header.Set("Authorization", "Bearer "+alice)
+
+	rr := httptest.NewRecorder()
+
+	app.routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("duplicating: got status %d; want %d", rr.Code, http.StatusCreated)
+	}
+
+	var duplicate struct {
+		Todo struct {
+			ID          int64      `json:"id"`
+			Title       string     `json:"title"`
+			Description string     `json:"description"`
+			DueDate     *time.Time `json:"due_date"`
+			IsCompleted bool       `json:"is_completed"`
+		} `json:"todo"`
+	}
+
+	decode(t, rr, &duplicate)
+
+	if duplicate.Todo.ID == original.Todo.ID {
+		t.Error("the duplicate has the original's id")
+	}
+
+	if want := fmt.Sprintf("/v1/todos/%d", duplicate.Todo.ID); !strings.HasSuffix(rr.Header().Get("Location"), want) {
+		t.Errorf("got Location %q; want it to end in %q", rr.Header().Get("Location"), want)
+	}
+
+	if duplicate.Todo.Title != "Water the plants (copy)" || duplicate.Todo.Description != "The ferns too" {
+		t.Errorf("got title %q and description %q", duplicate.Todo.Title, duplicate.Todo.Description)
+	}
+
+	if duplicate.Todo.DueDate == nil || !duplicate.Todo.DueDate.Equal(dueDate) {
+		t.Errorf("got due_date %v; want %v", duplicate.Todo.DueDate, dueDate)
+	}
+
+	if duplicate.Todo.IsCompleted {
+		t.Error("the duplicate is completed")
+	}
+
+	if status := do(t, app, http.MethodPost, path+"/duplicate", bob, nil, nil); status != http.StatusNotFound {
+		t.Errorf("another user's todo: got status %d; want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestDuplicateTodoLongTitle(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.todos.maxTitleLength = 20
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	_, id := createTodo(t, app, token, strings.Repeat("a", 20))
+
+	var duplicate struct {
+		Todo struct {
+			Title string `json:"title"`
+		} `json:"todo"`
+	}
+
+	status := do(t, app, http.MethodPost, fmt.Sprintf("/v1/todos/%d/duplicate", id), token, nil, &duplicate)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	// The title is cut to keep the copy within the configured limit.
+	if want := strings.Repeat("a", 13) + " (copy)"; duplicate.Todo.Title != want {
+		t.Errorf("got title %q; want %q", duplicate.Todo.Title, want)
+	}
+}
+
+func TestCreateTodoWhitespaceTitle(t *testing.T) {
+	app := newTestApplication(t)
+
+	status := doAs(t, app, app.createTodoHandler, &data.User{Id: 1}, http.MethodPost, "/v1/todos", map[string]any{"title": "   "}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestCreateTodoTrimsTitle(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var response struct {
+		Todo struct {
+			Title string `json:"title"`
+		} `json:"todo"`
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/todos", token, map[string]any{"title": "  Buy milk \n"}, &response)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if response.Todo.Title != "Buy milk" {
+		t.Errorf("got title %q; want %q", response.Todo.Title, "Buy milk")
+	}
+}
+
+func TestListTodosMaxPageSize(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.pagination.maxPageSize = 20
+
+	// 21 would be allowed by the built-in maximum.
+	status := doAs(t, app, app.listTodosHandler, &data.User{Id: 1}, http.MethodGet, "/v1/todos?page_size=21", nil, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestListTodosDefaultPageSize(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.config.pagination.defaultPageSize = 2
+	app.config.pagination.maxPageSize = 3
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	for i := range 3 {
+		createTodo(t, app, token, fmt.Sprintf("Todo %d", i))
+	}
+
+	var response struct {
+		Todos    []json.RawMessage `json:"todos"`
+		Metadata data.Metadata     `json:"metadata"`
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/todos", token, nil, &response); status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if len(response.Todos) != 2 || response.Metadata.PageSize != 2 {
+		t.Errorf("got %d todos with page_size %d; want 2 with page_size 2", len(response.Todos), response.Metadata.PageSize)
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/todos?page_size=3", token, nil, nil); status != http.StatusOK {
+		t.Errorf("page_size at the maximum: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/todos?page_size=4", token, nil, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("page_size over the maximum: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestOverdueTodos(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	todos := []struct {
+		title     string
+		dueIn     *time.Duration
+		completed bool
+	}{
+		{"Slightly overdue", durationPtr(-time.Hour), false},
+		{"Not yet due", durationPtr(24 * time.Hour), false},
+		{"Completed late", durationPtr(-24 * time.Hour), true},
+		{"Very overdue", durationPtr(-48 * time.Hour), false},
+		{"Someday", nil, false},
+	}
+
+	for _, todo := range todos {
+		status, id := createTodo(t, app, token, todo.title)
+		if status != http.StatusCreated {
+			t.Fatalf("creating %q: got status %d; want %d", todo.title, status, http.StatusCreated)
+		}
+
+		// Past due dates can't be set through the API.
+		if todo.dueIn != nil {
+			_, err := app.db.Exec(context.Background(), "UPDATE todos SET due_date = $1, is_completed = $2 WHERE id = $3", time.Now().Add(*todo.dueIn), todo.completed, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var list todoList
+
+	if status := do(t, app, http.MethodGet, "/v1/todos/overdue", token, nil, &list); status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if got, want := list.titles(), []string{"Very overdue", "Slightly overdue"}; !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestCompletedTodos(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	from := time.Date(2025, time.January, 6, 0, 0, 0, 0, time.UTC)
+	to := from.Add(7 * 24 * time.Hour)
+
+	todos := []struct {
+		title       string
+		completedAt time.Time
+	}{
+		{"Before", from.Add(-time.Second)},
+		{"Last", to},
+		{"First", from},
+		{"Middle", from.Add(72 * time.Hour)},
+		{"After", to.Add(time.Second)},
+	}
+
+	for _, todo := range todos {
+		_, id := createTodo(t, app, token, todo.title)
+
+		_, err := app.db.Exec(context.Background(), "UPDATE todos SET is_completed = true, completed_at = $1 WHERE id = $2", todo.completedAt, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	createTodo(t, app, token, "Pending")
+
+	var list todoList
+
+	path := fmt.Sprintf("/v1/todos/completed?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+
+	if status := do(t, app, http.MethodGet, path, token, nil, &list); status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if got, want := list.titles(), []string{"First", "Middle", "Last"}; !slices.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestCompletedTodosInvalidRange(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"from after to", "from=2025-01-13T00:00:00Z&to=2025-01-06T00:00:00Z"},
+		{"missing to", "from=2025-01-06T00:00:00Z"},
+		{"malformed from", "from=monday&to=2025-01-06T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := doAs(t, app, app.completedTodosHandler, &data.User{Id: 1}, http.MethodGet, "/v1/todos/completed?"+tt.query, nil, nil)
+			if status != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+			}
+		})
+	}
+}
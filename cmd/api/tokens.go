@@ -3,8 +3,12 @@ package main
 import (
 	"GoTodo/internal/data"
 	"GoTodo/internal/data/validator"
+	"GoTodo/internal/jwt"
+	"GoTodo/internal/totp"
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -12,6 +16,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		TOTPCode string `json:"totp_code"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -20,6 +25,8 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	input.Email = data.NormalizeEmail(input.Email)
+
 	v := validator.New()
 
 	data.ValidateEmail(v, input.Email)
@@ -30,10 +37,17 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	user, err := app.models.Users.GetByEmail(input.Email)
+	if app.loginLimiter.locked(input.Email) {
+		app.accountLockedResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			app.loginLimiter.recordFailure(input.Email)
+			app.audit(r, nil, data.AuditSignInFailed, "user", nil)
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -49,17 +63,295 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
+		app.loginLimiter.recordFailure(input.Email)
+		app.audit(r, &user.Id, data.AuditSignInFailed, "user", &user.Id)
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.Id, 24*time.Hour, data.ScopeAuthentication)
+	if user.TOTPEnabled {
+		if input.TOTPCode == "" {
+			v.AddError("totp_code", "must be provided")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		if !totp.Validate(input.TOTPCode, user.TOTPSecret, time.Now(), 1) {
+			app.loginLimiter.recordFailure(input.Email)
+			app.audit(r, &user.Id, data.AuditSignInFailed, "user", &user.Id)
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+	}
+
+	app.loginLimiter.reset(input.Email)
+
+	var env envelope
+
+	err = app.models.WithTx(r.Context(), func(models data.Models) error {
+		env, err = app.newTokenPair(r.Context(), models, user.Id, "")
+		return err
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &user.Id, data.AuditSignIn, "user", &user.Id)
+
+	// Returning the profile saves clients a request right after signing in.
+	env["user"] = user
+
+	err = app.writeJSON(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Tokens.GetForToken(r.Context(), data.ScopeRefresh, input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	var env envelope
+
+	err = app.models.WithTx(r.Context(), func(models data.Models) error {
+		// Deleting the refresh token before issuing a new pair makes it single
+		// use: if a concurrent request already rotated it there is nothing
+		// left to delete and the request is rejected.
+		sessionID, err := models.Tokens.Delete(r.Context(), data.ScopeRefresh, input.RefreshToken)
+		if err != nil {
+			return err
+		}
+
+		// The new pair replaces the session's authentication token as well,
+		// and keeps the session id so the session can still be revoked.
+		if sessionID != "" {
+			err = models.Tokens.DeleteSession(r.Context(), user.Id, sessionID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		env, err = app.newTokenPair(r.Context(), models, user.Id, sessionID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	app.audit(r, &user.Id, data.AuditTokenRefresh, "user", &user.Id)
+
+	err = app.writeJSON(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// newTokenPair issues a short-lived authentication token and a long-lived
+// refresh token for the user, both belonging to the given session. An empty
+// sessionID starts a new session.
+// In JWT mode the authentication token is a signed JWT that isn't stored;
+// refresh tokens stay in the database either way.
+func (app *application) newTokenPair(ctx context.Context, models data.Models, userID int64, sessionID string) (envelope, error) {
+	var err error
+
+	if sessionID == "" {
+		sessionID, err = data.NewSessionID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var authenticationToken *data.Token
+
+	if app.config.auth.mode == authModeJWT {
+		authenticationToken, err = app.newJWT(userID, sessionID)
+	} else {
+		authenticationToken, err = models.Tokens.NewForSession(ctx, userID, app.config.auth.tokenTTL, data.ScopeAuthentication, sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := models.Tokens.NewForSession(ctx, userID, app.config.auth.refreshTokenTTL, data.ScopeRefresh, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{"authentication_token": authenticationToken, "refresh_token": refreshToken}, nil
+}
+
+func (app *application) newJWT(userID int64, sessionID string) (*data.Token, error) {
+	now := time.Now()
+	expiry := now.Add(app.config.auth.tokenTTL)
+
+	claims := jwt.Claims{
+		Subject:   strconv.FormatInt(userID, 10),
+		SessionID: sessionID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiry.Unix(),
+	}
+
+	token, err := jwt.Sign(claims, []byte(app.config.auth.jwtSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{Plaintext: token, UserID: userID, Expiry: expiry, Scope: data.ScopeAuthentication, SessionID: sessionID, CreatedAt: now}, nil
+}
+
+// userForJWT verifies the JWT and loads the user it was issued to.
+func (app *application) userForJWT(ctx context.Context, token string) (*data.User, error) {
+	claims, err := jwt.Verify(token, []byte(app.config.auth.jwtSecret), time.Now())
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return app.models.Users.Get(ctx, userID)
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Tokens.GetSessionsForUser(r.Context(), user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	currentSessionID, err := app.currentSessionID(r)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// currentSessionID returns the session of the token the request was
+// authenticated with.
+func (app *application) currentSessionID(r *http.Request) (string, error) {
+	token, _ := app.readBearerToken(r)
+
+	if app.config.auth.mode == authModeJWT {
+		claims, err := jwt.Verify(token, []byte(app.config.auth.jwtSecret), time.Now())
+		if err != nil {
+			return "", nil
+		}
+
+		return claims.SessionID, nil
+	}
+
+	sessionID, err := app.models.Tokens.SessionIDForToken(r.Context(), data.ScopeAuthentication, token)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return "", nil
+	}
+
+	return sessionID, err
+}
+
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readSessionIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Tokens.DeleteSession(r.Context(), user.Id, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	app.audit(r, &user.Id, data.AuditSessionRevoke, "session", nil)
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "session revoked successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAllSessionsHandler signs the user out everywhere by revoking all of
+// their authentication and refresh tokens, including the one used for this
+// request.
+func (app *application) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var revoked int64
+
+	err := app.models.WithTx(r.Context(), func(models data.Models) error {
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+			count, err := models.Tokens.DeleteAllForUser(r.Context(), scope, user.Id)
+			if err != nil {
+				return err
+			}
+
+			revoked += count
+		}
+
+		return nil
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &user.Id, data.AuditSessionRevoke, "sessions", nil)
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "all sessions revoked successfully", "revoked": revoked}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"GoTodo/internal/data"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type tokenPair struct {
+	AuthenticationToken struct {
+		Token string `json:"token"`
+	} `json:"authentication_token"`
+	RefreshToken struct {
+		Token string `json:"token"`
+	} `json:"refresh_token"`
+}
+
+func signIn(t *testing.T, app *application, email string) tokenPair {
+	t.Helper()
+
+	var pair tokenPair
+
+	status := do(t, app, http.MethodPost, "/v1/auth/sign-in", "", map[string]string{"email": email, "password": "pa55word"}, &pair)
+	if status != http.StatusCreated {
+		t.Fatalf("signing in: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	return pair
+}
+
+func refresh(t *testing.T, app *application, refreshToken string) (int, tokenPair) {
+	t.Helper()
+
+	var pair tokenPair
+
+	status := do(t, app, http.MethodPost, "/v1/auth/refresh", "", map[string]string{"refresh_token": refreshToken}, &pair)
+
+	return status, pair
+}
+
+type sessionList struct {
+	Sessions []data.Session `json:"sessions"`
+}
+
+func TestRefreshAuthenticationToken(t *testing.T) {
+	app := newTestDBApplication(t)
+	insertTestUser(t, app, "alice@example.com")
+
+	first := signIn(t, app, "alice@example.com")
+
+	status, second := refresh(t, app, first.RefreshToken.Token)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if second.RefreshToken.Token == first.RefreshToken.Token {
+		t.Error("the refresh token wasn't rotated")
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/auth/sessions", second.AuthenticationToken.Token, nil, nil); status != http.StatusOK {
+		t.Errorf("new authentication token: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/auth/sessions", first.AuthenticationToken.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("replaced authentication token: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+
+	if status, _ := refresh(t, app, first.RefreshToken.Token); status != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+
+	var sessions sessionList
+
+	do(t, app, http.MethodGet, "/v1/auth/sessions", second.AuthenticationToken.Token, nil, &sessions)
+
+	if len(sessions.Sessions) != 1 {
+		t.Fatalf("got %d sessions; want 1, the rotated one", len(sessions.Sessions))
+	}
+
+	if !sessions.Sessions[0].Current {
+		t.Error("the rotated session isn't marked as current")
+	}
+}
+
+func TestRefreshExpiredToken(t *testing.T) {
+	app := newTestDBApplication(t)
+	user := insertTestUser(t, app, "alice@example.com")
+
+	token, err := app.models.Tokens.NewForSession(context.Background(), user.Id, -time.Minute, data.ScopeRefresh, "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := refresh(t, app, token.Plaintext); status != http.StatusUnauthorized {
+		t.Errorf("got status %d; want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	app := newTestDBApplication(t)
+	insertTestUser(t, app, "alice@example.com")
+
+	laptop := signIn(t, app, "alice@example.com")
+	phone := signIn(t, app, "alice@example.com")
+
+	var sessions sessionList
+
+	do(t, app, http.MethodGet, "/v1/auth/sessions", laptop.AuthenticationToken.Token, nil, &sessions)
+
+	if len(sessions.Sessions) != 2 {
+		t.Fatalf("got %d sessions; want 2", len(sessions.Sessions))
+	}
+
+	var phoneSession string
+
+	for _, session := range sessions.Sessions {
+		if !session.Current {
+			phoneSession = session.ID
+		}
+	}
+
+	if phoneSession == "" {
+		t.Fatal("no session other than the current one")
+	}
+
+	status := do(t, app, http.MethodDelete, "/v1/auth/sessions/"+phoneSession, laptop.AuthenticationToken.Token, nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/auth/sessions", phone.AuthenticationToken.Token, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("revoked authentication token: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+
+	if status, _ := refresh(t, app, phone.RefreshToken.Token); status != http.StatusUnauthorized {
+		t.Errorf("revoked refresh token: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+
+	status, laptop = refresh(t, app, laptop.RefreshToken.Token)
+	if status != http.StatusCreated {
+		t.Fatalf("other session's refresh token: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	sessions = sessionList{}
+
+	do(t, app, http.MethodGet, "/v1/auth/sessions", laptop.AuthenticationToken.Token, nil, &sessions)
+
+	if len(sessions.Sessions) != 1 || sessions.Sessions[0].ID == phoneSession {
+		t.Errorf("got sessions %+v; want only the laptop's", sessions.Sessions)
+	}
+
+	status = do(t, app, http.MethodDelete, "/v1/auth/sessions/"+phoneSession, laptop.AuthenticationToken.Token, nil, nil)
+	if status != http.StatusNotFound {
+		t.Errorf("revoking it again: got status %d; want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestDeleteAllSessions(t *testing.T) {
+	app := newTestDBApplication(t)
+	insertTestUser(t, app, "alice@example.com")
+	insertTestUser(t, app, "bob@example.com")
+
+	laptop := signIn(t, app, "alice@example.com")
+	phone := signIn(t, app, "alice@example.com")
+	bob := signIn(t, app, "bob@example.com")
+
+	var response struct {
+		Revoked int64 `json:"revoked"`
+	}
+
+	status := do(t, app, http.MethodDelete, "/v1/auth/sessions", laptop.AuthenticationToken.Token, nil, &response)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	if response.Revoked != 4 {
+		t.Errorf("got %d tokens revoked; want 4", response.Revoked)
+	}
+
+	for _, pair := range []tokenPair{laptop, phone} {
+		if status := do(t, app, http.MethodGet, "/v1/auth/sessions", pair.AuthenticationToken.Token, nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("revoked authentication token: got status %d; want %d", status, http.StatusUnauthorized)
+		}
+
+		if status, _ := refresh(t, app, pair.RefreshToken.Token); status != http.StatusUnauthorized {
+			t.Errorf("revoked refresh token: got status %d; want %d", status, http.StatusUnauthorized)
+		}
+	}
+
+	if status := do(t, app, http.MethodGet, "/v1/auth/sessions", bob.AuthenticationToken.Token, nil, nil); status != http.StatusOK {
+		t.Errorf("other user's authentication token: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if status, _ := refresh(t, app, bob.RefreshToken.Token); status != http.StatusCreated {
+		t.Errorf("other user's refresh token: got status %d; want %d", status, http.StatusCreated)
+	}
+}
+
+func TestSignInUserProfile(t *testing.T) {
+	app := newTestDBApplication(t)
+	user := insertTestUser(t, app, "alice@example.com")
+
+	var response struct {
+		tokenPair
+		User map[string]any `json:"user"`
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/auth/sign-in", "", map[string]string{"email": "alice@example.com", "password": "pa55word"}, &response)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if response.AuthenticationToken.Token == "" {
+		t.Error("got no authentication token")
+	}
+
+	if response.User["id"] != float64(user.Id) || response.User["name"] != "Test User" || response.User["email"] != "alice@example.com" {
+		t.Errorf("got user %v; want alice's id, name and email", response.User)
+	}
+
+	for _, field := range []string{"password", "totp_secret"} {
+		if _, ok := response.User[field]; ok {
+			t.Errorf("got user %v; want no %s", response.User, field)
+		}
+	}
+}
+
+func TestSignInLockout(t *testing.T) {
+	app := newTestDBApplication(t)
+	app.loginLimiter = newLoginLimiter(3, time.Minute, time.Minute)
+
+	insertTestUser(t, app, "alice@example.com")
+
+	signInWith := func(password string) int {
+		t.Helper()
+
+		return do(t, app, http.MethodPost, "/v1/auth/sign-in", "", map[string]string{"email": "alice@example.com", "password": password}, nil)
+	}
+
+	// A correct password before the lockout resets the failures.
+	for range 2 {
+		signInWith("wrongpassword")
+	}
+
+	if status := signInWith("pa55word"); status != http.StatusCreated {
+		t.Fatalf("correct password: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	for i := range 3 {
+		if status := signInWith("wrongpassword"); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: got status %d; want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+
+	if status := signInWith("pa55word"); status != http.StatusTooManyRequests {
+		t.Errorf("locked out: got status %d; want %d", status, http.StatusTooManyRequests)
+	}
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"GoTodo/internal/data"
 	"GoTodo/internal/data/validator"
+	"GoTodo/internal/totp"
 	"errors"
 	"net/http"
+	"time"
 )
 
 func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.config.registrationEnabled {
+		app.registrationDisabledResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Name     string `json:"name"`
 		Email    string `json:"email"`
@@ -38,12 +45,177 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	var env envelope
+
+	// The account is only created along with its tokens, so a failure to
+	// issue them doesn't leave behind an email address a retry can't use.
+	err = app.models.WithTx(r.Context(), func(models data.Models) error {
+		err := models.Users.Insert(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		env, err = app.newTokenPair(r.Context(), models, user.Id, "")
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	env["user"] = user
+
+	err = app.writeJSON(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	v := validator.New()
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// A new email address only replaces the current one once it's confirmed
+	// with the token issued here; until then the old address stays active.
+	newEmail := ""
+	if input.Email != nil && data.NormalizeEmail(*input.Email) != user.Email {
+		newEmail = data.NormalizeEmail(*input.Email)
+
+		if data.ValidateEmail(v, newEmail); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		_, err = app.models.Users.GetByEmail(r.Context(), newEmail)
+		switch {
+		case err == nil:
+			v.AddError("email", "a user with this email already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	env := envelope{"user": user}
+
+	if newEmail != "" {
+		token, err := app.models.Tokens.NewEmailChange(r.Context(), user.Id, newEmail, 24*time.Hour)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			data := map[string]any{
+				"name":  user.Name,
+				"token": token.Plaintext,
+			}
+
+			err := app.mailer.Send(newEmail, "email_change.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error(), "recipient", newEmail)
+			}
+		})
+
+		env["message"] = "a confirmation token has been sent to the new email address, the current address stays active until it's confirmed"
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlainText(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userID, email, err := app.models.Tokens.GetEmailChange(r.Context(), input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.models.WithTx(r.Context(), func(models data.Models) error {
+		err := models.Users.UpdateEmail(r.Context(), userID, email)
+		if err != nil {
+			return err
+		}
+
+		_, err = models.Tokens.DeleteAllForUser(r.Context(), data.ScopeEmailChange, userID)
+		return err
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "a user with this email already exists")
 			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -51,7 +223,158 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "email address updated successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidatePasswordPlainText(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Delete(r.Context(), user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "account deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) checkEmailAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	email := app.readString(r.URL.Query(), "email", "")
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	available := false
+
+	_, err := app.models.Users.GetByEmail(r.Context(), email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			available = true
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"available": available}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) enableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if user.TOTPEnabled {
+		v := validator.New()
+		v.AddError("totp", "two-factor authentication is already enabled")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.SetTOTPSecret(r.Context(), user.Id, secret)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"secret":      secret,
+		"otpauth_url": totp.URL("GoTodo", user.Email, secret),
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) verifyTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+
+	v.Check(user.TOTPSecret != "", "totp", "two-factor authentication must be enabled first")
+	v.Check(input.Code != "", "code", "must be provided")
+
+	if v.Valid() {
+		v.Check(totp.Validate(input.Code, user.TOTPSecret, time.Now(), 1), "code", "is invalid or expired")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.EnableTOTP(r.Context(), user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "two-factor authentication enabled successfully"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
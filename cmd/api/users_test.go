@@ -0,0 +1,402 @@
+package main
+
+import (
+	"GoTodo/internal/totp"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateUser(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	var response struct {
+		tokenPair
+		User struct {
+			ID    int64  `json:"id"`
+			Email string `json:"email"`
+		} `json:"user"`
+	}
+
+	body := map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}
+
+	status := do(t, app, http.MethodPost, "/v1/users", "", body, &response)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d", status, http.StatusCreated)
+	}
+
+	if response.User.Email != "alice@example.com" {
+		t.Errorf("got email %q; want %q", response.User.Email, "alice@example.com")
+	}
+
+	token := response.AuthenticationToken.Token
+	if token == "" {
+		t.Fatal("got no authentication token")
+	}
+
+	status = do(t, app, http.MethodGet, "/v1/todos", token, nil, nil)
+	if status != http.StatusOK {
+		t.Errorf("using the token: got status %d; want %d", status, http.StatusOK)
+	}
+}
+
+func TestCreateUserRegistrationDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.registrationEnabled = false
+
+	var response struct {
+		Error string `json:"error"`
+	}
+
+	body := map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}
+
+	status := do(t, app, http.MethodPost, "/v1/users", "", body, &response)
+	if status != http.StatusForbidden {
+		t.Fatalf("got status %d; want %d", status, http.StatusForbidden)
+	}
+
+	if want := "registration is currently disabled"; response.Error != want {
+		t.Errorf("got error %q; want %q", response.Error, want)
+	}
+}
+
+func TestSignInRegistrationDisabled(t *testing.T) {
+	app := newTestDBApplication(t)
+	insertTestUser(t, app, "alice@example.com")
+
+	app.config.registrationEnabled = false
+
+	// Existing users can still sign in; signIn fails the test otherwise.
+	signIn(t, app, "alice@example.com")
+}
+
+func TestCreateUserTokenFailure(t *testing.T) {
+	app := newTestDBApplication(t)
+	ctx := context.Background()
+
+	// Make issuing tokens fail, as only this test's schema sees it.
+	_, err := app.db.Exec(ctx, "ALTER TABLE tokens ADD CONSTRAINT no_tokens CHECK (false) NOT VALID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}
+
+	status := do(t, app, http.MethodPost, "/v1/users", "", body, nil)
+	if status != http.StatusInternalServerError {
+		t.Fatalf("got status %d; want %d", status, http.StatusInternalServerError)
+	}
+
+	_, err = app.db.Exec(ctx, "ALTER TABLE tokens DROP CONSTRAINT no_tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed request mustn't have kept the account, or the retry would be
+	// told the email address is taken.
+	status = do(t, app, http.MethodPost, "/v1/users", "", body, nil)
+	if status != http.StatusCreated {
+		t.Errorf("retry: got status %d; want %d", status, http.StatusCreated)
+	}
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	app := newTestDBApplication(t)
+	insertTestUser(t, app, "alice@example.com")
+
+	var response struct {
+		Error map[string]string `json:"error"`
+	}
+
+	body := map[string]string{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}
+
+	status := do(t, app, http.MethodPost, "/v1/users", "", body, &response)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	if response.Error["email"] == "" {
+		t.Errorf("got errors %v; want an email error", response.Error)
+	}
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	user := insertTestUser(t, app, "alice@example.com")
+	token := authenticate(t, app, user)
+
+	if status, _ := createTodo(t, app, token, "Buy milk"); status != http.StatusCreated {
+		t.Fatalf("creating a todo: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	status := do(t, app, http.MethodDelete, "/v1/users/me", token, map[string]string{"password": "wrongpassword"}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("wrong password: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	status = do(t, app, http.MethodDelete, "/v1/users/me", token, map[string]string{"password": "pa55word"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+
+	for _, table := range []string{"todos", "tokens"} {
+		var count int
+
+		err := app.db.QueryRow(context.Background(), "SELECT count(*) FROM "+table+" WHERE user_id = $1", user.Id).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 0 {
+			t.Errorf("got %d %s left; want 0", count, table)
+		}
+	}
+
+	status = do(t, app, http.MethodGet, "/v1/todos", token, nil, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("using the old token: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestCheckEmailAvailability(t *testing.T) {
+	app := newTestDBApplication(t)
+	insertTestUser(t, app, "alice@example.com")
+
+	tests := []struct {
+		name  string
+		email string
+		want  bool
+	}{
+		{"taken", "alice@example.com", false},
+		{"taken in another case", "Alice@Example.com", false},
+		{"free", "bob@example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response struct {
+				Available bool `json:"available"`
+			}
+
+			status := do(t, app, http.MethodGet, "/v1/users/email-available?email="+url.QueryEscape(tt.email), "", nil, &response)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d; want %d", status, http.StatusOK)
+			}
+
+			if response.Available != tt.want {
+				t.Errorf("got available %t; want %t", response.Available, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckEmailAvailabilityInvalid(t *testing.T) {
+	app := newTestApplication(t)
+
+	status := doAs(t, app, app.checkEmailAvailabilityHandler, nil, http.MethodGet, "/v1/users/email-available?email=not-an-email", nil, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+
+	var enabled struct {
+		Secret     string `json:"secret"`
+		OTPAuthURL string `json:"otpauth_url"`
+	}
+
+	status := do(t, app, http.MethodPost, "/v1/users/me/2fa/enable", token, nil, &enabled)
+	if status != http.StatusOK {
+		t.Fatalf("enabling: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if enabled.Secret == "" || !strings.HasPrefix(enabled.OTPAuthURL, "otpauth://totp/") {
+		t.Fatalf("enabling: got secret %q and URL %q", enabled.Secret, enabled.OTPAuthURL)
+	}
+
+	status = do(t, app, http.MethodPost, "/v1/users/me/2fa/verify", token, map[string]string{"code": "000000"}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("verifying a wrong code: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	code := func() string {
+		t.Helper()
+
+		code, err := totp.GenerateCode(enabled.Secret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return code
+	}
+
+	status = do(t, app, http.MethodPost, "/v1/users/me/2fa/verify", token, map[string]string{"code": code()}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("verifying: got status %d; want %d", status, http.StatusOK)
+	}
+
+	credentials := map[string]string{"email": "alice@example.com", "password": "pa55word"}
+
+	status = do(t, app, http.MethodPost, "/v1/auth/sign-in", "", credentials, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("signing in without a code: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	credentials["totp_code"] = code()
+
+	status = do(t, app, http.MethodPost, "/v1/auth/sign-in", "", credentials, nil)
+	if status != http.StatusCreated {
+		t.Errorf("signing in with a code: got status %d; want %d", status, http.StatusCreated)
+	}
+}
+
+func TestEmailCaseInsensitive(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	body := map[string]string{"name": "Alice", "email": "Alice@Example.com", "password": "pa55word"}
+
+	if status := do(t, app, http.MethodPost, "/v1/users", "", body, nil); status != http.StatusCreated {
+		t.Fatalf("registering: got status %d; want %d", status, http.StatusCreated)
+	}
+
+	body["email"] = "alice@example.COM"
+
+	if status := do(t, app, http.MethodPost, "/v1/users", "", body, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("registering in another case: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	for _, email := range []string{"alice@example.com", "ALICE@EXAMPLE.COM"} {
+		signIn(t, app, email)
+	}
+}
+
+type sentEmail struct {
+	recipient    string
+	templateFile string
+	data         map[string]any
+}
+
+// testMailer passes every email it's asked to send to sent.
+type testMailer struct {
+	sent chan sentEmail
+}
+
+func (m testMailer) Send(recipient, templateFile string, data any) error {
+	m.sent <- sentEmail{recipient: recipient, templateFile: templateFile, data: data.(map[string]any)}
+	return nil
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	mailer := testMailer{sent: make(chan sentEmail, 1)}
+	app.mailer = mailer
+
+	token := authenticate(t, app, insertTestUser(t, app, "alice@example.com"))
+	insertTestUser(t, app, "bob@example.com")
+
+	var response struct {
+		User struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"user"`
+	}
+
+	status := do(t, app, http.MethodPatch, "/v1/users/me", token, map[string]string{"name": "Alice Smith"}, &response)
+	if status != http.StatusOK {
+		t.Fatalf("changing the name: got status %d; want %d", status, http.StatusOK)
+	}
+
+	if response.User.Name != "Alice Smith" || response.User.Email != "alice@example.com" {
+		t.Errorf("changing the name: got %+v", response.User)
+	}
+
+	status = do(t, app, http.MethodPatch, "/v1/users/me", token, map[string]string{"email": "bob@example.com"}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("changing to a taken email: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	var changed map[string]any
+
+	status = do(t, app, http.MethodPatch, "/v1/users/me", token, map[string]string{"email": "alice@example.org"}, &changed)
+	if status != http.StatusOK {
+		t.Fatalf("changing the email: got status %d; want %d", status, http.StatusOK)
+	}
+
+	// The token only goes out by email.
+	if _, ok := changed["email_change_token"]; ok {
+		t.Errorf("got response %v; want no token in it", changed)
+	}
+
+	var confirmation string
+
+	select {
+	case email := <-mailer.sent:
+		if email.recipient != "alice@example.org" || email.templateFile != "email_change.tmpl" {
+			t.Errorf("got %s sent to %s; want email_change.tmpl sent to the new address", email.templateFile, email.recipient)
+		}
+
+		confirmation, _ = email.data["token"].(string)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no confirmation email was sent")
+	}
+
+	status = do(t, app, http.MethodPut, "/v1/users/email", "", map[string]string{"token": confirmation}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("confirming the email: got status %d; want %d", status, http.StatusOK)
+	}
+
+	signIn(t, app, "alice@example.org")
+}
+
+func TestEmailChangeConfirmation(t *testing.T) {
+	app := newTestDBApplication(t)
+
+	mailer := testMailer{sent: make(chan sentEmail, 1)}
+	app.mailer = mailer
+
+	user := insertTestUser(t, app, "alice@example.com")
+	token := authenticate(t, app, user)
+
+	credentials := func(email string) map[string]string {
+		return map[string]string{"email": email, "password": "pa55word"}
+	}
+
+	status := do(t, app, http.MethodPatch, "/v1/users/me", token, map[string]string{"email": "alice@example.org"}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("changing the email: got status %d; want %d", status, http.StatusOK)
+	}
+
+	select {
+	case <-mailer.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no confirmation email was sent")
+	}
+
+	// Until the change is confirmed the old address stays in use.
+	signIn(t, app, "alice@example.com")
+
+	if status := do(t, app, http.MethodPost, "/v1/auth/sign-in", "", credentials("alice@example.org"), nil); status != http.StatusUnauthorized {
+		t.Errorf("signing in with the unconfirmed email: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+
+	expired, err := app.models.Tokens.NewEmailChange(context.Background(), user.Id, "alice@example.net", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status = do(t, app, http.MethodPut, "/v1/users/email", "", map[string]string{"token": expired.Plaintext}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("confirming with an expired token: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+
+	signIn(t, app, "alice@example.com")
+}
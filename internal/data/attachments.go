@@ -0,0 +1,100 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+	"unicode/utf8"
+)
+
+// attachmentsJSON builds the attachments array embedded in the todo queries.
+const attachmentsJSON = `COALESCE((
+	    SELECT json_agg(json_build_object(
+	        'id', todo_attachments.id,
+	        'created_at', todo_attachments.created_at,
+	        'url', todo_attachments.url,
+	        'filename', todo_attachments.filename
+	    ) ORDER BY todo_attachments.id)
+	    FROM todo_attachments
+	    WHERE todo_attachments.todo_id = todos.id
+	), '[]')`
+
+type Attachment struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Filename  string    `json:"filename"`
+}
+
+type AttachmentsModel struct {
+	DB DBTX
+}
+
+// Insert adds an attachment to a todo owned by userId, otherwise it returns
+// ErrRecordNotFound.
+func (a *AttachmentsModel) Insert(ctx context.Context, todoId int64, userId int64, attachment *Attachment) error {
+	query := `
+	INSERT INTO todo_attachments (todo_id, url, filename)
+	SELECT id, $3, $4
+	FROM todos
+	WHERE id = $1 AND user_id = $2
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{todoId, userId, attachment.URL, attachment.Filename}
+
+	err := a.DB.QueryRow(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return constraintError(err)
+		}
+	}
+
+	return nil
+}
+
+func (a *AttachmentsModel) Delete(ctx context.Context, id int64, todoId int64, userId int64) error {
+	query := `
+	DELETE FROM todo_attachments
+	USING todos
+	WHERE todos.id = todo_attachments.todo_id
+	AND todo_attachments.id = $1 AND todo_attachments.todo_id = $2 AND todos.user_id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{id, todoId, userId}
+
+	result, err := a.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.URL != "", "url", "must be provided")
+	v.Check(len(attachment.URL) <= 2048, "url", "must not be more than 2048 bytes long")
+
+	if attachment.URL != "" {
+		u, err := url.Parse(attachment.URL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be a valid http or https URL")
+	}
+
+	v.Check(utf8.RuneCountInString(attachment.Filename) <= 255, "filename", "must not be more than 255 characters long")
+}
@@ -0,0 +1,37 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"strings"
+	"testing"
+)
+
+func TestValidateAttachment(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		valid bool
+	}{
+		{"https", "https://example.com/report.pdf", true},
+		{"http", "http://example.com", true},
+		{"missing", "", false},
+		{"no scheme", "example.com/report.pdf", false},
+		{"other scheme", "ftp://example.com/report.pdf", false},
+		{"javascript", "javascript:alert(1)", false},
+		{"no host", "https:///report.pdf", false},
+		{"malformed", "https://exa mple.com/%zz", false},
+		{"too long", "https://example.com/" + strings.Repeat("a", 2048), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateAttachment(v, &Attachment{URL: tt.url})
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	AuditTodoCreate    = "todo.create"
+	AuditTodoUpdate    = "todo.update"
+	AuditTodoDelete    = "todo.delete"
+	AuditSignIn        = "auth.sign_in"
+	AuditSignInFailed  = "auth.sign_in_failed"
+	AuditTokenRefresh  = "auth.refresh"
+	AuditSessionRevoke = "auth.session_revoke"
+)
+
+// AuditEntry records that a user did something to a resource. UserID is nil
+// for actions by unknown users, such as a sign-in attempt for an email that
+// doesn't exist, and once the user has been deleted.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	UserID     *int64    `json:"user_id"`
+	Action     string    `json:"action"`
+	Resource   string    `json:"resource"`
+	ResourceID *int64    `json:"resource_id"`
+	At         time.Time `json:"at"`
+}
+
+type AuditModel struct {
+	DB DBTX
+}
+
+func (a *AuditModel) Record(ctx context.Context, userId *int64, action string, resource string, resourceId *int64) error {
+	query := `
+	INSERT INTO audit_log (user_id, action, resource, resource_id)
+	VALUES ($1, $2, $3, $4)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{userId, action, resource, resourceId}
+
+	_, err := a.DB.Exec(ctx, query, args...)
+	return err
+}
+
+func (a *AuditModel) GetAll(ctx context.Context, filters Filters) ([]*AuditEntry, Metadata, error) {
+	orderBy, err := filters.orderBy()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	countQuery := `
+	SELECT count(*)
+	FROM audit_log
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var totalRecords int
+
+	err = a.DB.QueryRow(ctx, countQuery).Scan(&totalRecords)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+	SELECT id, user_id, action, resource, resource_id, at
+	FROM audit_log
+	ORDER BY %s
+	LIMIT $1 OFFSET $2
+	`, orderBy)
+
+	args := []any{filters.limit(), filters.offset()}
+
+	rows, err := a.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.Resource, &entry.ResourceID, &entry.At)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
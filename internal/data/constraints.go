@@ -0,0 +1,48 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrCheckViolation      = errors.New("check constraint violation")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+)
+
+// ConstraintError is a check or foreign key violation reported by the
+// database. It matches ErrCheckViolation or ErrForeignKeyViolation with
+// errors.Is.
+type ConstraintError struct {
+	Kind       error
+	Constraint string
+	Column     string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Constraint)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Kind
+}
+
+// constraintError turns check (23514) and foreign key (23503) violations into
+// a *ConstraintError. Any other error, including nil, is returned as is.
+func constraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	switch pgErr.Code {
+	case "23514":
+		return &ConstraintError{Kind: ErrCheckViolation, Constraint: pgErr.ConstraintName, Column: pgErr.ColumnName}
+	case "23503":
+		return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: pgErr.ConstraintName, Column: pgErr.ColumnName}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestConstraintError(t *testing.T) {
+	errOther := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		err      error
+		wantKind error
+	}{
+		{"check violation", &pgconn.PgError{Code: "23514", ConstraintName: "todos_title_check"}, ErrCheckViolation},
+		{"foreign key violation", &pgconn.PgError{Code: "23503", ConstraintName: "todos_project_id_fkey"}, ErrForeignKeyViolation},
+		{"unique violation", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}, nil},
+		{"other error", errOther, nil},
+		{"nil", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := constraintError(tt.err)
+
+			if tt.wantKind == nil {
+				if err != tt.err {
+					t.Errorf("got error %v; want %v unchanged", err, tt.err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.wantKind) {
+				t.Fatalf("got error %v; want %v", err, tt.wantKind)
+			}
+
+			var constraintErr *ConstraintError
+			if !errors.As(err, &constraintErr) {
+				t.Fatalf("got error %T; want *ConstraintError", err)
+			}
+
+			if want := tt.err.(*pgconn.PgError).ConstraintName; constraintErr.Constraint != want {
+				t.Errorf("got constraint %q; want %q", constraintErr.Constraint, want)
+			}
+		})
+	}
+}
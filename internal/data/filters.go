@@ -2,52 +2,161 @@ package data
 
 import (
 	"GoTodo/internal/data/validator"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// ErrInvalidOrder is returned when a query is built from an order value that
+// isn't in the safe list, which means it skipped validation.
+var ErrInvalidOrder = errors.New("invalid order")
+
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page"`
-	TotalRecords int `json:"total_records"`
+	CurrentPage  int   `json:"current_page,omitempty"`
+	PageSize     int   `json:"page_size,omitempty"`
+	FirstPage    int   `json:"first_page,omitempty"`
+	LastPage     int   `json:"last_page"`
+	TotalRecords int   `json:"total_records"`
+	NextPage     *int  `json:"next_page"`
+	PrevPage     *int  `json:"prev_page"`
+	NextCursor   int64 `json:"next_cursor,omitempty"`
 }
 
 type Filters struct {
 	Page          int
 	PageSize      int
+	MaxPageSize   int
 	Sort          string
 	Order         string
 	SortSafeList  []string
 	OrderSafeList []string
+	AfterID       *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
-	return Metadata{
+	metadata := Metadata{
 		CurrentPage:  page,
 		PageSize:     pageSize,
 		FirstPage:    1,
 		LastPage:     (totalRecords + pageSize - 1) / pageSize,
 		TotalRecords: totalRecords,
 	}
+
+	if page < metadata.LastPage {
+		nextPage := page + 1
+		metadata.NextPage = &nextPage
+	}
+
+	if page > 1 {
+		prevPage := min(page-1, max(metadata.LastPage, 1))
+		metadata.PrevPage = &prevPage
+	}
+
+	return metadata
+}
+
+func calculateCursorMetadata(totalRecords, pageSize int, todos []*Todo) Metadata {
+	metadata := Metadata{
+		PageSize:     pageSize,
+		TotalRecords: totalRecords,
+	}
+
+	if len(todos) == pageSize {
+		metadata.NextCursor = todos[len(todos)-1].ID
+	}
+
+	return metadata
 }
 
-func (f *Filters) sortColumn() string {
+func (f *Filters) sortFields() []string {
+	return strings.Split(f.Sort, ",")
+}
+
+func (f *Filters) sortColumn(field string) string {
+	column := strings.TrimPrefix(field, "-")
+
 	for _, safeValue := range f.SortSafeList {
-		if f.Sort == safeValue {
-			return f.Sort
+		if column == safeValue {
+			if expression, ok := sortExpressions[column]; ok {
+				return expression
+			}
+
+			return column
+		}
+	}
+
+	panic("unsafe sort parameter: " + field)
+}
+
+// sortDirection only accepts values from the safe list, so an order that
+// skipped validation is an error instead of silently sorting descending.
+func (f *Filters) sortDirection() (string, error) {
+	for _, safeValue := range f.OrderSafeList {
+		if f.Order == safeValue {
+			switch f.Order {
+			case "asc":
+				return "ASC", nil
+			case "desc":
+				return "DESC", nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidOrder, f.Order)
+}
+
+// orderBy builds the ORDER BY clause from the sort fields. A "-" prefix sorts a
+// field descending and a bare field ascending, except that the order parameter
+// still decides the direction when a single bare field is given.
+func (f *Filters) orderBy() (string, error) {
+	order, err := f.sortDirection()
+	if err != nil {
+		return "", err
+	}
+
+	clauses := []string{}
+
+	fields := f.sortFields()
+
+	for _, field := range fields {
+		// sortColumn is called first so fixed expressions are checked against
+		// the safe list too.
+		column := f.sortColumn(field)
+
+		if expression, ok := fixedSortExpressions[strings.TrimPrefix(field, "-")]; ok {
+			clauses = append(clauses, expression)
+			continue
+		}
+
+		direction := "ASC"
+		switch {
+		case strings.HasPrefix(field, "-"):
+			direction = "DESC"
+		case len(fields) == 1:
+			direction = order
 		}
+
+		clauses = append(clauses, fmt.Sprintf("%s %s", column, direction))
 	}
 
-	panic("unsafe sort parameter: " + f.Sort)
+	clauses = append(clauses, "id ASC")
+
+	return strings.Join(clauses, ", "), nil
 }
 
-func (f *Filters) sortDirection() string {
-	if f.Order == "asc" {
-		return "ASC"
+// DefaultMaxPageSize is the largest page size allowed when Filters.MaxPageSize
+// isn't set.
+const DefaultMaxPageSize = 100
+
+func (f *Filters) maxPageSize() int {
+	if f.MaxPageSize > 0 {
+		return f.MaxPageSize
 	}
 
-	return "DESC"
+	return DefaultMaxPageSize
 }
 
 func (f *Filters) limit() int {
@@ -58,12 +167,54 @@ func (f *Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+func (f *Filters) pagination() (string, error) {
+	if f.AfterID != nil {
+		return "AND id > $8 ORDER BY id ASC LIMIT $7", nil
+	}
+
+	orderBy, err := f.orderBy()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("ORDER BY %s LIMIT $7 OFFSET $8", orderBy), nil
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page > 0, "page", "must be greater than 0")
 	v.Check(f.Page <= 10_000_000, "page", "must be less than ten million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than 0")
-	v.Check(f.PageSize <= 100, "page_size", "must be less than a hundred")
+	v.Check(f.PageSize <= f.maxPageSize(), "page_size", fmt.Sprintf("must not be more than %d", f.maxPageSize()))
+
+	if f.AfterID != nil {
+		v.Check(*f.AfterID >= 0, "after_id", "must not be negative")
+	}
+
+	if f.CreatedAfter != nil && f.CreatedBefore != nil {
+		v.Check(!f.CreatedBefore.Before(*f.CreatedAfter), "created_before", "must not be before created_after")
+	}
+
+	ValidateSort(v, f)
+}
+
+// ValidateSort checks only the sort and order values, for endpoints that order
+// their results but don't paginate them.
+func ValidateSort(v *validator.Validator, f Filters) {
+	for _, field := range f.sortFields() {
+		column := strings.TrimPrefix(field, "-")
+		v.Check(validator.PermittedValue(column, f.SortSafeList...), "sort", fmt.Sprintf(`"%v" is an invalid sort value, use one of the following: %v`, field, f.SortSafeList))
+	}
 
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", fmt.Sprintf(`"%v" is an invalid sort value, use one of the following: %v`, f.Sort, f.SortSafeList))
 	v.Check(validator.PermittedValue(f.Order, f.OrderSafeList...), "order", fmt.Sprintf(`"%v" is an invalid order value, use one of the following: %v`, f.Order, f.OrderSafeList))
 }
+
+// ValidatePageInRange checks, once the total is known, that the requested page
+// isn't past the last one. An empty result still has a first page.
+func ValidatePageInRange(v *validator.Validator, f Filters, metadata Metadata) {
+	if f.AfterID != nil {
+		return
+	}
+
+	lastPage := max(metadata.LastPage, 1)
+	v.Check(f.Page <= lastPage, "page", fmt.Sprintf("must not be greater than the last page (%d)", lastPage))
+}
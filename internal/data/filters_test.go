@@ -0,0 +1,208 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func todoFilters(sort, order string) Filters {
+	return Filters{
+		Page:          1,
+		PageSize:      10,
+		Sort:          sort,
+		Order:         order,
+		SortSafeList:  []string{"is_completed", "due_date", "created_at", "title", "position", "smart", "relevance"},
+		OrderSafeList: []string{"asc", "desc"},
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		name  string
+		sort  string
+		order string
+		want  string
+	}{
+		{"single field", "created_at", "desc", "created_at DESC, id ASC"},
+		{"single field ascending", "created_at", "asc", "created_at ASC, id ASC"},
+		{"single descending field", "-created_at", "asc", "created_at DESC, id ASC"},
+		{"two fields", "due_date,-created_at", "desc", "due_date ASC, created_at DESC, id ASC"},
+		{"two descending fields", "-due_date,-title", "asc", "due_date DESC, title DESC, id ASC"},
+		{"fixed expression", "smart,-created_at", "desc", "is_completed ASC, due_date ASC, created_at DESC, id ASC"},
+		{"sort expression", "-relevance", "asc", "ts_rank(tsv, plainto_tsquery('simple', $2)) DESC, id ASC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := todoFilters(tt.sort, tt.order)
+
+			got, err := f.orderBy()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortDirection(t *testing.T) {
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{"asc", "ASC"},
+		{"desc", "DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			f := todoFilters("created_at", tt.order)
+
+			got, err := f.sortDirection()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortDirectionInvalid(t *testing.T) {
+	for _, order := range []string{"", "ASC", "descending", "desc; DROP TABLE todos"} {
+		t.Run(order, func(t *testing.T) {
+			f := todoFilters("created_at", order)
+
+			_, err := f.sortDirection()
+			if !errors.Is(err, ErrInvalidOrder) {
+				t.Errorf("sortDirection: got error %v; want %v", err, ErrInvalidOrder)
+			}
+
+			_, err = f.orderBy()
+			if !errors.Is(err, ErrInvalidOrder) {
+				t.Errorf("orderBy: got error %v; want %v", err, ErrInvalidOrder)
+			}
+
+			_, err = f.pagination()
+			if !errors.Is(err, ErrInvalidOrder) {
+				t.Errorf("pagination: got error %v; want %v", err, ErrInvalidOrder)
+			}
+		})
+	}
+}
+
+func TestValidateSort(t *testing.T) {
+	tests := []struct {
+		name  string
+		sort  string
+		valid bool
+	}{
+		{"two fields", "due_date,-title", true},
+		{"invalid field", "due_date,-priority", false},
+		{"empty field", "due_date,", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateSort(v, todoFilters(tt.sort, "asc"))
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+
+			if !tt.valid && v.Errors["sort"] == "" {
+				t.Errorf("got errors %v; want a sort error", v.Errors)
+			}
+		})
+	}
+}
+
+func TestCalculateMetadataPageLinks(t *testing.T) {
+	page := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		page     int
+		nextPage *int
+		prevPage *int
+	}{
+		{"first page", 1, page(2), nil},
+		{"middle page", 2, page(3), page(1)},
+		{"last page", 3, nil, page(2)},
+		{"past the last page", 5, nil, page(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := calculateMetadata(25, tt.page, 10)
+
+			if !equalPage(metadata.NextPage, tt.nextPage) {
+				t.Errorf("got next page %s; want %s", formatPage(metadata.NextPage), formatPage(tt.nextPage))
+			}
+
+			if !equalPage(metadata.PrevPage, tt.prevPage) {
+				t.Errorf("got previous page %s; want %s", formatPage(metadata.PrevPage), formatPage(tt.prevPage))
+			}
+		})
+	}
+}
+
+func equalPage(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func formatPage(p *int) string {
+	if p == nil {
+		return "nil"
+	}
+
+	return strconv.Itoa(*p)
+}
+
+func TestValidatePageInRange(t *testing.T) {
+	afterID := int64(10)
+
+	tests := []struct {
+		name         string
+		page         int
+		afterID      *int64
+		totalRecords int
+		valid        bool
+	}{
+		{"first page", 1, nil, 25, true},
+		{"last page", 3, nil, 25, true},
+		{"beyond the last page", 4, nil, 25, false},
+		{"first page of nothing", 1, nil, 0, true},
+		{"second page of nothing", 2, nil, 0, false},
+		{"cursor pagination", 4, &afterID, 25, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := todoFilters("created_at", "desc")
+			f.Page = tt.page
+			f.AfterID = tt.afterID
+
+			v := validator.New()
+
+			ValidatePageInRange(v, f, calculateMetadata(tt.totalRecords, tt.page, f.PageSize))
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
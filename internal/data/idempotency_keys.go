@@ -0,0 +1,76 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrIdempotencyKeyUsed = errors.New("idempotency key already used")
+
+type IdempotencyKeysModel struct {
+	DB DBTX
+}
+
+func ValidateIdempotencyKey(v *validator.Validator, key string) {
+	v.Check(utf8.RuneCountInString(key) <= 255, "idempotency_key", "must not be more than 255 characters long")
+}
+
+func (m *IdempotencyKeysModel) GetTodoID(ctx context.Context, userId int64, key string) (int64, error) {
+	query := `
+	SELECT todo_id
+	FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2 AND expiry > $3
+	`
+
+	args := []any{userId, key, time.Now()}
+
+	var todoId int64
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&todoId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return todoId, nil
+}
+
+// Insert claims the key for todoId, or returns ErrIdempotencyKeyUsed if it
+// hasn't expired yet. An insert racing another transaction's claim on the same
+// key waits for that transaction to finish, so only one of them succeeds.
+func (m *IdempotencyKeysModel) Insert(ctx context.Context, userId int64, key string, todoId int64, ttl time.Duration) error {
+	query := `
+	INSERT INTO idempotency_keys (user_id, key, todo_id, expiry)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id, key) DO UPDATE
+	SET todo_id = EXCLUDED.todo_id, expiry = EXCLUDED.expiry
+	WHERE idempotency_keys.expiry <= NOW()
+	`
+
+	args := []any{userId, key, todoId, time.Now().Add(ttl)}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := m.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrIdempotencyKeyUsed
+	}
+
+	return nil
+}
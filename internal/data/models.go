@@ -1,15 +1,38 @@
 package data
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// DBTX is the subset of pgx shared by *pgxpool.Pool and pgx.Tx, so the same
+// models can run against the pool or inside a transaction.
+type DBTX interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
 type Models struct {
-	Todos  TodosModel
-	Users  UsersModel
-	Tokens TokensModel
+	Todos           TodosModel
+	Users           UsersModel
+	Tokens          TokensModel
+	IdempotencyKeys IdempotencyKeysModel
+	Subtasks        SubtasksModel
+	Projects        ProjectsModel
+	Attachments     AttachmentsModel
+	Audit           AuditModel
+	Schema          SchemaModel
+
+	db    DBTX
+	hooks *commitHooks
 }
 
 var (
@@ -17,10 +40,112 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
-func NewModels(db *pgxpool.Pool) Models {
+// queryTimeout bounds how long a single query may run before its context is
+// cancelled.
+var queryTimeout = 3 * time.Second
+
+func SetQueryTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("query timeout must be a positive duration")
+	}
+
+	queryTimeout = timeout
+
+	return nil
+}
+
+// bulkQueryTimeout bounds imports and exports, which run a query per todo or
+// stream every todo a user has and so need longer than a single query.
+var bulkQueryTimeout = 30 * time.Second
+
+func SetBulkQueryTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("bulk query timeout must be a positive duration")
+	}
+
+	bulkQueryTimeout = timeout
+
+	return nil
+}
+
+func NewModels(db DBTX) Models {
+	return newModels(db, nil)
+}
+
+func newModels(db DBTX, hooks *commitHooks) Models {
 	return Models{
-		Todos:  TodosModel{DB: db},
-		Users:  UsersModel{DB: db},
-		Tokens: TokensModel{DB: db},
+		Todos:           TodosModel{DB: db},
+		Users:           UsersModel{DB: db, hooks: hooks},
+		Tokens:          TokensModel{DB: db, hooks: hooks},
+		IdempotencyKeys: IdempotencyKeysModel{DB: db},
+		Subtasks:        SubtasksModel{DB: db},
+		Projects:        ProjectsModel{DB: db},
+		Attachments:     AttachmentsModel{DB: db},
+		Audit:           AuditModel{DB: db},
+		Schema:          SchemaModel{DB: db},
+		db:              db,
+		hooks:           hooks,
+	}
+}
+
+// commitHooks collects work that must wait until the transaction it depends on
+// has committed, such as evicting cached tokens: done any earlier, a
+// concurrent request could cache the rows again before they change. A nil
+// *commitHooks stands for models that aren't in a transaction, where the work
+// runs right away.
+type commitHooks struct {
+	fns []func()
+}
+
+func (h *commitHooks) afterCommit(fn func()) {
+	if h == nil {
+		fn()
+		return
+	}
+
+	h.fns = append(h.fns, fn)
+}
+
+// WithTx runs fn with a copy of the models bound to a new transaction, which is
+// committed if fn returns nil and rolled back if it returns an error or panics.
+// Work the models defer until the commit runs only once it succeeds.
+// Calling WithTx on models that are already bound to a transaction nests it
+// as a savepoint.
+func (m Models) WithTx(ctx context.Context, fn func(Models) error) (err error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	hooks := &commitHooks{}
+
+	err = fn(newModels(tx, hooks))
+	if err != nil {
+		rollbackErr := tx.Rollback(ctx)
+		if rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+
+		return err
 	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Releasing a savepoint doesn't commit anything yet, so its hooks are
+	// handed on to the enclosing transaction.
+	for _, fn := range hooks.fns {
+		m.hooks.afterCommit(fn)
+	}
+
+	return nil
 }
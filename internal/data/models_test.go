@@ -0,0 +1,187 @@
+package data
+
+import (
+	"GoTodo/internal/testdb"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSetQueryTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if err := SetQueryTimeout(timeout); err == nil {
+			t.Errorf("SetQueryTimeout(%s): got no error", timeout)
+		}
+
+		if err := SetBulkQueryTimeout(timeout); err == nil {
+			t.Errorf("SetBulkQueryTimeout(%s): got no error", timeout)
+		}
+	}
+}
+
+// lockTodos holds an exclusive lock on the todos table until the test ends,
+// so any query on it blocks.
+func lockTodos(t *testing.T, models Models) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	tx, err := models.db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback(ctx) })
+
+	_, err = tx.Exec(ctx, "LOCK TABLE todos IN ACCESS EXCLUSIVE MODE")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sortedFilters() Filters {
+	return Filters{Page: 1, PageSize: 10, Sort: "id", Order: "asc", SortSafeList: []string{"id"}, OrderSafeList: []string{"asc", "desc"}}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	models := NewModels(testdb.New(t))
+
+	previous := queryTimeout
+	t.Cleanup(func() { queryTimeout = previous })
+
+	err := SetQueryTimeout(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockTodos(t, models)
+
+	start := time.Now()
+
+	_, _, err = models.Todos.GetAll(context.Background(), 1, "", nil, nil, sortedFilters())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the query took %s to time out", elapsed)
+	}
+}
+
+func TestBulkQueryTimeout(t *testing.T) {
+	models := NewModels(testdb.New(t))
+
+	previous := bulkQueryTimeout
+	t.Cleanup(func() { bulkQueryTimeout = previous })
+
+	err := SetBulkQueryTimeout(50 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockTodos(t, models)
+
+	start := time.Now()
+
+	err = models.Todos.Export(context.Background(), 1, "", nil, nil, sortedFilters(), func(*Todo) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Export: got error %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	err = models.Todos.Import(context.Background(), 1, []*Todo{{Title: "Imported"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Import: got error %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the queries took %s to time out", elapsed)
+	}
+}
+
+func TestWithTxRollback(t *testing.T) {
+	models := NewModels(testdb.New(t))
+	user := insertTestUser(t, models)
+
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	countTodos := func() int {
+		t.Helper()
+
+		count, err := models.Todos.CountForUser(ctx, user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return count
+	}
+
+	insert := func(m Models, title string) error {
+		return m.Todos.Insert(ctx, user.Id, &Todo{Title: title, Recurrence: RecurrenceNone, Tags: []string{}})
+	}
+
+	err := models.WithTx(ctx, func(m Models) error {
+		for _, title := range []string{"First", "Second"} {
+			if err := insert(m, title); err != nil {
+				return err
+			}
+		}
+
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("got error %v; want %v", err, errFailed)
+	}
+
+	if count := countTodos(); count != 0 {
+		t.Errorf("after an error: got %d todos; want 0", count)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic wasn't propagated")
+			}
+		}()
+
+		models.WithTx(ctx, func(m Models) error {
+			if err := insert(m, "Panicked"); err != nil {
+				return err
+			}
+
+			panic("boom")
+		})
+	}()
+
+	if count := countTodos(); count != 0 {
+		t.Errorf("after a panic: got %d todos; want 0", count)
+	}
+
+	// A failing nested transaction only rolls back its own writes.
+	err = models.WithTx(ctx, func(m Models) error {
+		if err := insert(m, "Outer"); err != nil {
+			return err
+		}
+
+		err := m.WithTx(ctx, func(m Models) error {
+			if err := insert(m, "Inner"); err != nil {
+				return err
+			}
+
+			return errFailed
+		})
+		if !errors.Is(err, errFailed) {
+			return fmt.Errorf("nested: got error %v; want %v", err, errFailed)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := countTodos(); count != 1 {
+		t.Errorf("after a failed nested transaction: got %d todos; want 1", count)
+	}
+}
@@ -0,0 +1,168 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrDuplicateProjectName = errors.New("duplicate project name")
+
+type Project struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Version   int32     `json:"version"`
+}
+
+type ProjectsModel struct {
+	DB DBTX
+}
+
+func (p *ProjectsModel) Insert(ctx context.Context, userId int64, project *Project) error {
+	query := `
+	INSERT INTO projects (user_id, name)
+	VALUES ($1, $2)
+	RETURNING id, created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{userId, project.Name}
+
+	err := p.DB.QueryRow(ctx, query, args...).Scan(&project.ID, &project.CreatedAt, &project.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "projects_user_id_name_key":
+			return ErrDuplicateProjectName
+		default:
+			return constraintError(err)
+		}
+	}
+
+	return nil
+}
+
+func (p *ProjectsModel) Get(ctx context.Context, id int64, userId int64) (*Project, error) {
+	query := `
+	SELECT id, created_at, name, version
+	FROM projects
+	WHERE id = $1 AND user_id = $2
+	`
+
+	var project Project
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := p.DB.QueryRow(ctx, query, id, userId).Scan(&project.ID, &project.CreatedAt, &project.Name, &project.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &project, nil
+}
+
+func (p *ProjectsModel) GetAll(ctx context.Context, userId int64) ([]*Project, error) {
+	query := `
+	SELECT id, created_at, name, version
+	FROM projects
+	WHERE user_id = $1
+	ORDER BY name, id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := p.DB.Query(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []*Project{}
+
+	for rows.Next() {
+		var project Project
+
+		err := rows.Scan(&project.ID, &project.CreatedAt, &project.Name, &project.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, &project)
+	}
+
+	return projects, rows.Err()
+}
+
+func (p *ProjectsModel) Update(ctx context.Context, userId int64, project *Project) error {
+	query := `
+	UPDATE projects
+	SET name = $1, version = version + 1
+	WHERE id = $2 AND user_id = $3 AND version = $4
+	RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{project.Name, project.ID, userId, project.Version}
+
+	err := p.DB.QueryRow(ctx, query, args...).Scan(&project.Version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "projects_user_id_name_key":
+			return ErrDuplicateProjectName
+		default:
+			return constraintError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the project. Its todos are kept and simply lose their
+// project, which the project_id foreign key takes care of.
+func (p *ProjectsModel) Delete(ctx context.Context, id int64, userId int64) error {
+	query := `
+	DELETE FROM projects
+	WHERE id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := p.DB.Exec(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateProject(v *validator.Validator, project *Project) {
+	v.Check(project.Name != "", "name", "must be provided")
+	v.Check(utf8.RuneCountInString(project.Name) <= 100, "name", "must not be more than 100 characters long")
+}
@@ -0,0 +1,74 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Read queries that fail with a transient connection error are retried with
+// exponential backoff. Writes never are, since it's impossible to tell whether
+// a failed write was applied.
+var (
+	readMaxAttempts = 3
+	readRetryDelay  = 50 * time.Millisecond
+)
+
+func SetReadRetries(maxAttempts int, delay time.Duration) error {
+	if maxAttempts < 1 {
+		return errors.New("read max attempts must be at least 1")
+	}
+
+	if delay < 0 {
+		return errors.New("read retry delay must not be negative")
+	}
+
+	readMaxAttempts = maxAttempts
+	readRetryDelay = delay
+
+	return nil
+}
+
+// retryRead calls fn until it succeeds, fails with an error that isn't
+// transient, runs out of attempts or ctx is done.
+func retryRead(ctx context.Context, fn func() error) error {
+	delay := readRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= readMaxAttempts || !isTransient(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		// admin_shutdown, crash_shutdown and cannot_connect_now.
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+
+		// Class 08 covers connection exceptions.
+		return len(pgErr.Code) == 5 && pgErr.Code[:2] == "08"
+	}
+
+	return pgconn.SafeToRetry(err) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fastReadRetries shortens the retry delay until the test ends.
+func fastReadRetries(t *testing.T, maxAttempts int) {
+	t.Helper()
+
+	attempts, delay := readMaxAttempts, readRetryDelay
+	t.Cleanup(func() { readMaxAttempts, readRetryDelay = attempts, delay })
+
+	err := SetReadRetries(maxAttempts, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+var errAdminShutdown = &pgconn.PgError{Code: "57P01"}
+
+func TestRetryRead(t *testing.T) {
+	fastReadRetries(t, 3)
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", nil, 1, nil},
+		{"transient failure then success", []error{errAdminShutdown}, 2, nil},
+		{"connection reset then success", []error{syscall.ECONNRESET}, 2, nil},
+		{"permanent failure", []error{pgx.ErrNoRows}, 1, pgx.ErrNoRows},
+		{"out of attempts", []error{errAdminShutdown, errAdminShutdown, errAdminShutdown, errAdminShutdown}, 3, errAdminShutdown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+
+			err := retryRead(context.Background(), func() error {
+				calls++
+
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls; want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryReadQueries(t *testing.T) {
+	fastReadRetries(t, 3)
+
+	failedOnce := false
+
+	db := &stubDB{queryRow: func(sql string) pgx.Row {
+		if !failedOnce {
+			failedOnce = true
+			return stubRow{err: errAdminShutdown}
+		}
+
+		if strings.Contains(sql, "DELETE") {
+			return stubRow{values: []any{"session"}}
+		}
+
+		return userRow(time.Now().Add(time.Hour))
+	}}
+
+	model := TokensModel{DB: db}
+
+	_, err := model.GetForToken(context.Background(), ScopeAuthentication, "token")
+	if err != nil {
+		t.Fatalf("read: got error %v", err)
+	}
+
+	if db.calls != 2 {
+		t.Errorf("read: got %d queries; want 2", db.calls)
+	}
+
+	// Writes aren't retried.
+	db.calls = 0
+	failedOnce = false
+
+	_, err = model.Delete(context.Background(), ScopeAuthentication, "token")
+	if !errors.Is(err, errAdminShutdown) {
+		t.Errorf("write: got error %v; want %v", err, errAdminShutdown)
+	}
+
+	if db.calls != 1 {
+		t.Errorf("write: got %d queries; want 1", db.calls)
+	}
+}
+
+func TestSetReadRetries(t *testing.T) {
+	fastReadRetries(t, 3)
+
+	if err := SetReadRetries(0, time.Millisecond); err == nil {
+		t.Error("zero attempts: got no error")
+	}
+
+	if err := SetReadRetries(3, -time.Millisecond); err == nil {
+		t.Error("negative delay: got no error")
+	}
+}
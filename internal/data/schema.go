@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SchemaModel reads the state golang-migrate keeps in schema_migrations.
+type SchemaModel struct {
+	DB DBTX
+}
+
+// Version returns the current migration version and whether the last
+// migration failed part way through. ErrRecordNotFound means no migration has
+// been run yet.
+func (s *SchemaModel) Version(ctx context.Context) (int64, bool, error) {
+	query := `
+	SELECT version, dirty
+	FROM schema_migrations
+	LIMIT 1
+	`
+
+	var version int64
+	var dirty bool
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := s.DB.QueryRow(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		// 42P01 (undefined_table): migrate hasn't created its table yet.
+		case errors.Is(err, sql.ErrNoRows), errors.As(err, &pgErr) && pgErr.Code == "42P01":
+			return 0, false, ErrRecordNotFound
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	errConn := errors.New("connection reset")
+
+	tests := []struct {
+		name      string
+		row       stubRow
+		wantVer   int64
+		wantDirty bool
+		wantErr   error
+	}{
+		{"clean", stubRow{values: []any{int64(24), false}}, 24, false, nil},
+		{"dirty", stubRow{values: []any{int64(23), true}}, 23, true, nil},
+		{"no migrations", stubRow{err: sql.ErrNoRows}, 0, false, ErrRecordNotFound},
+		{"no table", stubRow{err: &pgconn.PgError{Code: "42P01"}}, 0, false, ErrRecordNotFound},
+		{"other error", stubRow{err: errConn}, 0, false, errConn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &stubDB{queryRow: func(string) pgx.Row { return tt.row }}
+			schema := SchemaModel{DB: db}
+
+			version, dirty, err := schema.Version(context.Background())
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+
+			if version != tt.wantVer || dirty != tt.wantDirty {
+				t.Errorf("got version %d (dirty %t); want %d (dirty %t)", version, dirty, tt.wantVer, tt.wantDirty)
+			}
+		})
+	}
+}
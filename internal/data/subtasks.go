@@ -0,0 +1,203 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"unicode/utf8"
+)
+
+// subtasksJSON builds the subtasks array embedded in the todo queries, ordered
+// the same way SubtasksModel returns them.
+const subtasksJSON = `COALESCE((
+	    SELECT json_agg(json_build_object(
+	        'id', subtasks.id,
+	        'title', subtasks.title,
+	        'is_completed', subtasks.is_completed,
+	        'position', subtasks.position
+	    ) ORDER BY subtasks.position, subtasks.id)
+	    FROM subtasks
+	    WHERE subtasks.todo_id = todos.id
+	), '[]')`
+
+type Subtask struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	IsCompleted bool   `json:"is_completed"`
+	Position    int32  `json:"position"`
+}
+
+type SubtasksModel struct {
+	DB DBTX
+}
+
+// Insert appends a subtask to the end of the todo's checklist. The todo must be
+// owned by userId, otherwise ErrRecordNotFound is returned.
+func (s *SubtasksModel) Insert(ctx context.Context, todoId int64, userId int64, subtask *Subtask) error {
+	query := `
+	INSERT INTO subtasks (todo_id, title, is_completed, position)
+	SELECT todos.id, $3, $4, COALESCE((SELECT max(position) + 1 FROM subtasks WHERE todo_id = todos.id), 0)
+	FROM todos
+	WHERE todos.id = $1 AND todos.user_id = $2
+	RETURNING id, position
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{todoId, userId, subtask.Title, subtask.IsCompleted}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&subtask.ID, &subtask.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return constraintError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SubtasksModel) Get(ctx context.Context, id int64, todoId int64, userId int64) (*Subtask, error) {
+	query := `
+	SELECT subtasks.id, subtasks.title, subtasks.is_completed, subtasks.position
+	FROM subtasks
+	INNER JOIN todos ON todos.id = subtasks.todo_id
+	WHERE subtasks.id = $1 AND subtasks.todo_id = $2 AND todos.user_id = $3
+	`
+
+	var subtask Subtask
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{id, todoId, userId}
+
+	err := s.DB.QueryRow(ctx, query, args...).Scan(&subtask.ID, &subtask.Title, &subtask.IsCompleted, &subtask.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &subtask, nil
+}
+
+func (s *SubtasksModel) Update(ctx context.Context, todoId int64, userId int64, subtask *Subtask) error {
+	query := `
+	UPDATE subtasks
+	SET title = $1, is_completed = $2
+	FROM todos
+	WHERE todos.id = subtasks.todo_id
+	AND subtasks.id = $3 AND subtasks.todo_id = $4 AND todos.user_id = $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{subtask.Title, subtask.IsCompleted, subtask.ID, todoId, userId}
+
+	result, err := s.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return constraintError(err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Reorder sets each subtask's position to its index in ids. ids must list
+// every subtask of the todo exactly once, otherwise ErrRecordNotFound is
+// returned and nothing is changed.
+func (s *SubtasksModel) Reorder(ctx context.Context, todoId int64, userId int64, ids []int64) error {
+	query := `
+	UPDATE subtasks
+	SET position = ordered.position - 1
+	FROM unnest($3::bigint[]) WITH ORDINALITY AS ordered(id, position), todos
+	WHERE subtasks.id = ordered.id
+	AND todos.id = subtasks.todo_id
+	AND subtasks.todo_id = $1 AND todos.user_id = $2
+	`
+
+	countQuery := `
+	SELECT count(*)
+	FROM subtasks
+	INNER JOIN todos ON todos.id = subtasks.todo_id
+	WHERE subtasks.todo_id = $1 AND todos.user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var total int
+
+	err = tx.QueryRow(ctx, countQuery, todoId, userId).Scan(&total)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(ctx, query, todoId, userId, ids)
+	if err != nil {
+		return err
+	}
+
+	if total != len(ids) || result.RowsAffected() != int64(len(ids)) {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *SubtasksModel) Delete(ctx context.Context, id int64, todoId int64, userId int64) error {
+	query := `
+	DELETE FROM subtasks
+	USING todos
+	WHERE todos.id = subtasks.todo_id
+	AND subtasks.id = $1 AND subtasks.todo_id = $2 AND todos.user_id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{id, todoId, userId}
+
+	result, err := s.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateSubtask(v *validator.Validator, subtask *Subtask) {
+	v.Check(subtask.Title != "", "title", "must be provided")
+	v.Check(utf8.RuneCountInString(subtask.Title) <= 500, "title", "must not be more than 500 characters long")
+}
+
+func ValidateSubtaskOrder(v *validator.Validator, ids []int64) {
+	seen := make(map[int64]bool, len(ids))
+
+	for _, id := range ids {
+		v.Check(!seen[id], "ids", "must not contain duplicate values")
+		seen[id] = true
+	}
+}
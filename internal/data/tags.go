@@ -0,0 +1,118 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var TagRX = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
+// NormalizeTags lowercases and trims the tags and drops duplicates, so that
+// "Work" and "work" are the same tag. A nil slice stays nil.
+func NormalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized
+}
+
+func (t *TodosModel) AddTags(ctx context.Context, todoId int64, userId int64, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = addTags(ctx, tx, todoId, userId, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// addTags creates any of the user's tags that don't exist yet and links them to
+// the todo, as part of the caller's transaction.
+func addTags(ctx context.Context, tx pgx.Tx, todoId int64, userId int64, tags []string) error {
+	query := `
+	INSERT INTO tags (user_id, name)
+	SELECT $1, unnest($2::text[])
+	ON CONFLICT (user_id, name) DO NOTHING
+	`
+
+	tags = NormalizeTags(tags)
+
+	_, err := tx.Exec(ctx, query, userId, tags)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO todo_tags (todo_id, tag_id)
+	SELECT todos.id, tags.id
+	FROM todos
+	INNER JOIN tags ON tags.user_id = todos.user_id
+	WHERE todos.id = $1 AND todos.user_id = $2 AND tags.name = ANY($3)
+	ON CONFLICT DO NOTHING
+	`
+
+	_, err = tx.Exec(ctx, query, todoId, userId, tags)
+	return err
+}
+
+func (t *TodosModel) RemoveTags(ctx context.Context, todoId int64, userId int64, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query := `
+	DELETE FROM todo_tags
+	USING tags
+	WHERE todo_tags.tag_id = tags.id
+	AND todo_tags.todo_id = $1
+	AND tags.user_id = $2
+	AND tags.name = ANY($3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{todoId, userId, NormalizeTags(tags)}
+
+	_, err := t.DB.Exec(ctx, query, args...)
+	return err
+}
+
+func ValidateTags(v *validator.Validator, tags []string) {
+	v.Check(len(tags) <= 20, "tags", "must not contain more than 20 tags")
+
+	for _, tag := range tags {
+		v.Check(tag != "", "tags", "must not contain empty tags")
+		v.Check(utf8.RuneCountInString(tag) <= 50, "tags", "must not contain tags more than 50 characters long")
+		v.Check(tag == "" || validator.Matches(tag, TagRX), "tags", "must only contain letters, numbers, hyphens and underscores")
+	}
+}
@@ -0,0 +1,60 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  []string
+		valid bool
+	}{
+		{"valid", []string{"work", "home-office", "q3_goals"}, true},
+		{"none", []string{}, true},
+		{"empty tag", []string{"work", ""}, false},
+		{"invalid characters", []string{"work stuff"}, false},
+		{"too long", []string{strings.Repeat("a", 51)}, false},
+		{"too many", strings.Split(strings.Repeat("a,", 21), ",")[:21], false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateTags(v, tt.tags)
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"lowercase", []string{"work"}, []string{"work"}},
+		{"mixed case", []string{"Work", "HOME"}, []string{"work", "home"}},
+		{"whitespace", []string{" work\t"}, []string{"work"}},
+		{"duplicates across case", []string{"Work", "work", " WORK "}, []string{"work"}},
+		{"empty", []string{}, []string{}},
+		{"nil", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeTags(tt.tags)
+
+			if !slices.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("got %#v; want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,57 +6,192 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 )
 
+const (
+	RecurrenceNone    = "none"
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+// MaxTitleLength and MaxDescriptionLength are the longest title and
+// description, in characters, a todo may have unless configured otherwise.
+const (
+	MaxTitleLength       = 500
+	MaxDescriptionLength = 5000
+)
+
+var RecurrenceSafeList = []string{RecurrenceNone, RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly}
+
+// TodoFieldSafeList lists the todo JSON fields clients may select with the
+// fields query parameter.
+var TodoFieldSafeList = []string{
+	"id", "created_at", "title", "description", "due_date", "is_completed", "recurrence",
+	"project_id", "position", "tags", "version", "subtasks", "attachments", "shared",
+}
+
+// todosListFilter is the WHERE clause shared by the count and select queries in
+// GetAll. $1 is the user id, $2 the search term, $3 the tags, $4 the project
+// (or NULL for any project) and $5 and $6 the inclusive bounds on created_at
+// (or NULL for no bound) to filter by.
+// Todos shared with the user are included alongside the ones they own.
+const todosListFilter = `
+        (user_id = $1 OR id IN (
+            SELECT todo_id FROM todo_shares WHERE user_id = $1
+        ))
+        AND (tsv @@ plainto_tsquery('simple', $2) OR $2 = '')
+        AND (cardinality($3::text[]) = 0 OR id IN (
+            SELECT todo_tags.todo_id
+            FROM todo_tags
+            INNER JOIN tags ON tags.id = todo_tags.tag_id
+            WHERE tags.name = ANY($3)
+            GROUP BY todo_tags.todo_id
+            HAVING count(DISTINCT tags.name) = cardinality($3::text[])
+        ))
+        AND ($4::bigint IS NULL OR project_id = $4)
+        AND ($5::timestamptz IS NULL OR created_at >= $5)
+        AND ($6::timestamptz IS NULL OR created_at <= $6)`
+
+// sortExpressions maps sort values that don't correspond to a column to the
+// SQL expression they should be ordered by. $2 is the search term in GetAll.
+// The tsv column weighs title matches above description matches, so relevance
+// ranks todos matching on the title first.
+var sortExpressions = map[string]string{
+	"relevance": "ts_rank(tsv, plainto_tsquery('simple', $2))",
+}
+
+// fixedSortExpressions are sort values that carry their own direction, so the
+// order parameter and a "-" prefix don't apply to them. smart lists pending
+// todos before completed ones, each soonest due first.
+var fixedSortExpressions = map[string]string{
+	"smart": "is_completed ASC, due_date ASC",
+}
+
 type Todo struct {
-	ID          int64     `json:"id"`
-	CreatedAt   time.Time `json:"-"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	DueDate     time.Time `json:"due_date"`
-	IsCompleted bool      `json:"is_completed"`
+	ID          int64        `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	DueDate     *time.Time   `json:"due_date,omitempty"`
+	IsCompleted bool         `json:"is_completed"`
+	Recurrence  string       `json:"recurrence"`
+	ProjectID   *int64       `json:"project_id"`
+	Position    int32        `json:"position"`
+	Tags        []string     `json:"tags"`
+	Version     int32        `json:"version"`
+	Subtasks    []Subtask    `json:"subtasks"`
+	Attachments []Attachment `json:"attachments"`
+	Shared      bool         `json:"shared"`
 }
 
+type TodoStats struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Pending   int `json:"pending"`
+	Overdue   int `json:"overdue"`
+}
+
+// ErrQuotaExceeded is returned when a user already has as many todos as they
+// are allowed to.
+var ErrQuotaExceeded = errors.New("todo quota exceeded")
+
 type TodosModel struct {
-	DB *pgxpool.Pool
+	DB DBTX
 }
 
-func (t *TodosModel) Insert(userId int64, todo *Todo) error {
+func (t *TodosModel) Insert(ctx context.Context, userId int64, todo *Todo) error {
 	query := `
-	INSERT INTO todos (title, description, due_date, is_completed, user_id)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id, created_at
+	INSERT INTO todos (title, description, due_date, is_completed, completed_at, recurrence, user_id, project_id, position)
+	VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN NOW() END, $5, $6, $7, (SELECT COALESCE(max(position) + 1, 0) FROM todos WHERE user_id = $6))
+	RETURNING id, created_at, position, version
 	`
 
-	args := []any{todo.Title, todo.Description, todo.DueDate, todo.IsCompleted, userId}
+	args := []any{todo.Title, todo.Description, todo.DueDate, todo.IsCompleted, todo.Recurrence, userId, todo.ProjectID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	return t.DB.QueryRow(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt)
+	err := t.DB.QueryRow(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.Position, &todo.Version)
+	return constraintError(err)
 }
 
-func (t *TodosModel) Get(id int64, userId int64) (*Todo, error) {
+func (t *TodosModel) InsertBatch(ctx context.Context, userId int64, todos []*Todo) error {
+	query := `
+	INSERT INTO todos (title, description, due_date, is_completed, completed_at, recurrence, user_id, position)
+	VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN NOW() END, $5, $6, (SELECT COALESCE(max(position) + 1, 0) FROM todos WHERE user_id = $6))
+	RETURNING id, created_at, position, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, todo := range todos {
+		batch.Queue(query, todo.Title, todo.Description, todo.DueDate, todo.IsCompleted, todo.Recurrence, userId)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+
+	for _, todo := range todos {
+		err = results.QueryRow().Scan(&todo.ID, &todo.CreatedAt, &todo.Position, &todo.Version)
+		if err != nil {
+			results.Close()
+			return constraintError(err)
+		}
+	}
+
+	err = results.Close()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (t *TodosModel) Get(ctx context.Context, id int64, userId int64) (*Todo, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-	SELECT id, created_at, title, description, due_date, is_completed
+	SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+	    ARRAY(
+	        SELECT tags.name
+	        FROM todo_tags
+	        INNER JOIN tags ON tags.id = todo_tags.tag_id
+	        WHERE todo_tags.todo_id = todos.id
+	        ORDER BY tags.name
+	    ),
+	    ` + subtasksJSON + `,
+	    ` + attachmentsJSON + `,
+	    user_id <> $2
 	FROM todos
-	where id = $1 AND user_id = $2`
+	WHERE id = $1 AND (user_id = $2 OR id IN (
+	    SELECT todo_id FROM todo_shares WHERE user_id = $2
+	))`
 
 	var todo Todo
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
 	args := []any{id, userId}
 
-	err := t.DB.QueryRow(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.Title, &todo.Description, &todo.DueDate, &todo.IsCompleted)
+	err := retryRead(ctx, func() error {
+		return t.DB.QueryRow(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.Title, &todo.Description, &todo.DueDate, &todo.IsCompleted, &todo.Recurrence, &todo.ProjectID, &todo.Position, &todo.Version, &todo.Tags, &todo.Subtasks, &todo.Attachments, &todo.Shared)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -69,43 +204,67 @@ func (t *TodosModel) Get(id int64, userId int64) (*Todo, error) {
 	return &todo, nil
 }
 
-func (t *TodosModel) GetAll(userId int64, search string, filters Filters) ([]*Todo, Metadata, error) {
+func (t *TodosModel) GetAll(ctx context.Context, userId int64, search string, tags []string, projectId *int64, filters Filters) ([]*Todo, Metadata, error) {
+	pagination, err := filters.pagination()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
 	countQuery := `
         SELECT count(*)
         FROM todos
-        WHERE user_id = $1 AND(
-            to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR
-            to_tsvector('simple', description) @@ plainto_tsquery('simple', $2) OR
-            $2 = ''
-        )`
+        WHERE ` + todosListFilter
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	args := []any{userId, search}
+	tags = NormalizeTags(tags)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	args := []any{userId, search, tags, projectId, filters.CreatedAfter, filters.CreatedBefore}
 
 	var totalRecords int
 
-	err := t.DB.QueryRow(ctx, countQuery, args...).Scan(&totalRecords)
+	err = retryRead(ctx, func() error {
+		return t.DB.QueryRow(ctx, countQuery, args...).Scan(&totalRecords)
+	})
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 
 	todosQuery := fmt.Sprintf(`
-        SELECT id, created_at, title, description, due_date, is_completed
+        SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+            ARRAY(
+                SELECT tags.name
+                FROM todo_tags
+                INNER JOIN tags ON tags.id = todo_tags.tag_id
+                WHERE todo_tags.todo_id = todos.id
+                ORDER BY tags.name
+            ),
+            %s,
+            %s,
+            user_id <> $1
         FROM todos
-        WHERE user_id = $1 AND (
-            to_tsvector('simple', title) @@ plainto_tsquery('simple', $2) OR
-            to_tsvector('simple', description) @@ plainto_tsquery('simple', $2) OR
-            $2 = ''
-        )
-        ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4
-    `, filters.sortColumn(), filters.sortDirection())
+        WHERE %s
+        %s
+    `, subtasksJSON, attachmentsJSON, todosListFilter, pagination)
 
-	args = []any{userId, search, filters.limit(), filters.offset()}
+	args = []any{userId, search, tags, projectId, filters.CreatedAfter, filters.CreatedBefore, filters.limit()}
 
-	rows, err := t.DB.Query(ctx, todosQuery, args...)
+	if filters.AfterID != nil {
+		args = append(args, *filters.AfterID)
+	} else {
+		args = append(args, filters.offset())
+	}
+
+	var rows pgx.Rows
+
+	err = retryRead(ctx, func() error {
+		rows, err = t.DB.Query(ctx, todosQuery, args...)
+		return err
+	})
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -121,6 +280,14 @@ func (t *TodosModel) GetAll(userId int64, search string, filters Filters) ([]*To
 			&todo.Description,
 			&todo.DueDate,
 			&todo.IsCompleted,
+			&todo.Recurrence,
+			&todo.ProjectID,
+			&todo.Position,
+			&todo.Version,
+			&todo.Tags,
+			&todo.Subtasks,
+			&todo.Attachments,
+			&todo.Shared,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -128,11 +295,233 @@ func (t *TodosModel) GetAll(userId int64, search string, filters Filters) ([]*To
 		todos = append(todos, &todo)
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var metadata Metadata
+
+	if filters.AfterID != nil {
+		metadata = calculateCursorMetadata(totalRecords, filters.PageSize, todos)
+	} else {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+
 	return todos, metadata, nil
 }
 
-func (t *TodosModel) Delete(id int64, userId int64) error {
+// GetByIDs returns the todos among ids that the user owns or that are shared
+// with them, in the order the ids were given. Other ids are skipped.
+func (t *TodosModel) GetByIDs(ctx context.Context, ids []int64, userId int64) ([]*Todo, error) {
+	query := `
+	SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+	    ARRAY(
+	        SELECT tags.name
+	        FROM todo_tags
+	        INNER JOIN tags ON tags.id = todo_tags.tag_id
+	        WHERE todo_tags.todo_id = todos.id
+	        ORDER BY tags.name
+	    ),
+	    ` + subtasksJSON + `,
+	    ` + attachmentsJSON + `,
+	    user_id <> $2
+	FROM todos
+	WHERE id = ANY($1) AND (user_id = $2 OR id IN (
+	    SELECT todo_id FROM todo_shares WHERE user_id = $2
+	))
+	ORDER BY array_position($1, id)`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{ids, userId}
+
+	var rows pgx.Rows
+
+	err := retryRead(ctx, func() error {
+		var err error
+		rows, err = t.DB.Query(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []*Todo{}
+
+	for rows.Next() {
+		var todo Todo
+
+		err := rows.Scan(
+			&todo.ID,
+			&todo.CreatedAt,
+			&todo.Title,
+			&todo.Description,
+			&todo.DueDate,
+			&todo.IsCompleted,
+			&todo.Recurrence,
+			&todo.ProjectID,
+			&todo.Position,
+			&todo.Version,
+			&todo.Tags,
+			&todo.Subtasks,
+			&todo.Attachments,
+			&todo.Shared,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		todos = append(todos, &todo)
+	}
+
+	return todos, rows.Err()
+}
+
+// Import inserts the todos together with their tags, subtasks and attachments
+// in a single transaction, so either the whole set is imported or none of it is.
+func (t *TodosModel) Import(ctx context.Context, userId int64, todos []*Todo) error {
+	query := `
+	INSERT INTO todos (title, description, due_date, is_completed, completed_at, recurrence, user_id, position)
+	VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN NOW() END, $5, $6, (SELECT COALESCE(max(position) + 1, 0) FROM todos WHERE user_id = $6))
+	RETURNING id, created_at, position, version
+	`
+
+	subtaskQuery := `
+	INSERT INTO subtasks (todo_id, title, is_completed, position)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id
+	`
+
+	attachmentQuery := `
+	INSERT INTO todo_attachments (todo_id, url, filename)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, bulkQueryTimeout)
+	defer cancel()
+
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, todo := range todos {
+		args := []any{todo.Title, todo.Description, todo.DueDate, todo.IsCompleted, todo.Recurrence, userId}
+
+		err = tx.QueryRow(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.Position, &todo.Version)
+		if err != nil {
+			return constraintError(err)
+		}
+
+		if len(todo.Tags) > 0 {
+			err = addTags(ctx, tx, todo.ID, userId, todo.Tags)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := range todo.Subtasks {
+			subtask := &todo.Subtasks[i]
+			subtask.Position = int32(i)
+
+			err = tx.QueryRow(ctx, subtaskQuery, todo.ID, subtask.Title, subtask.IsCompleted, subtask.Position).Scan(&subtask.ID)
+			if err != nil {
+				return constraintError(err)
+			}
+		}
+
+		for i := range todo.Attachments {
+			attachment := &todo.Attachments[i]
+
+			err = tx.QueryRow(ctx, attachmentQuery, todo.ID, attachment.URL, attachment.Filename).Scan(&attachment.ID, &attachment.CreatedAt)
+			if err != nil {
+				return constraintError(err)
+			}
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Export calls fn for every todo matching the same filters as GetAll, in the
+// requested order but without pagination. Rows are read one at a time so the
+// whole result set is never held in memory.
+func (t *TodosModel) Export(ctx context.Context, userId int64, search string, tags []string, projectId *int64, filters Filters, fn func(*Todo) error) error {
+	orderBy, err := filters.orderBy()
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+        SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+            ARRAY(
+                SELECT tags.name
+                FROM todo_tags
+                INNER JOIN tags ON tags.id = todo_tags.tag_id
+                WHERE todo_tags.todo_id = todos.id
+                ORDER BY tags.name
+            ),
+            %s,
+            %s,
+            user_id <> $1
+        FROM todos
+        WHERE %s
+        ORDER BY %s
+    `, subtasksJSON, attachmentsJSON, todosListFilter, orderBy)
+
+	ctx, cancel := context.WithTimeout(ctx, bulkQueryTimeout)
+	defer cancel()
+
+	tags = NormalizeTags(tags)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	args := []any{userId, search, tags, projectId, filters.CreatedAfter, filters.CreatedBefore}
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todo Todo
+
+		err := rows.Scan(
+			&todo.ID,
+			&todo.CreatedAt,
+			&todo.Title,
+			&todo.Description,
+			&todo.DueDate,
+			&todo.IsCompleted,
+			&todo.Recurrence,
+			&todo.ProjectID,
+			&todo.Position,
+			&todo.Version,
+			&todo.Tags,
+			&todo.Subtasks,
+			&todo.Attachments,
+			&todo.Shared,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&todo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (t *TodosModel) Delete(ctx context.Context, id int64, userId int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
@@ -142,7 +531,7 @@ func (t *TodosModel) Delete(id int64, userId int64) error {
 	WHERE id = $1 AND user_id = $2
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
 	args := []any{id, userId}
@@ -161,39 +550,721 @@ func (t *TodosModel) Delete(id int64, userId int64) error {
 	return nil
 }
 
-func (t *TodosModel) Update(userId int64, todo *Todo) error {
+// DeleteReturning deletes one of the user's todos and returns it as it was
+// right before the delete, tags, subtasks and attachments included.
+func (t *TodosModel) DeleteReturning(ctx context.Context, id int64, userId int64) (*Todo, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Every part of the statement sees the rows as they were before it ran, so
+	// the cascaded tags, subtasks and attachments can still be read.
+	query := `
+	WITH deleted AS (
+	    DELETE FROM todos
+	    WHERE id = $1 AND user_id = $2
+	    RETURNING *
+	)
+	SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+	    ARRAY(
+	        SELECT tags.name
+	        FROM todo_tags
+	        INNER JOIN tags ON tags.id = todo_tags.tag_id
+	        WHERE todo_tags.todo_id = todos.id
+	        ORDER BY tags.name
+	    ),
+	    ` + subtasksJSON + `,
+	    ` + attachmentsJSON + `
+	FROM deleted AS todos
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var todo Todo
+
+	err := t.DB.QueryRow(ctx, query, id, userId).Scan(
+		&todo.ID,
+		&todo.CreatedAt,
+		&todo.Title,
+		&todo.Description,
+		&todo.DueDate,
+		&todo.IsCompleted,
+		&todo.Recurrence,
+		&todo.ProjectID,
+		&todo.Position,
+		&todo.Version,
+		&todo.Tags,
+		&todo.Subtasks,
+		&todo.Attachments,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &todo, nil
+}
+
+// DeleteMany deletes the todos among ids that the user owns and returns the ids
+// of the ones it deleted. Todos shared with the user are left alone.
+func (t *TodosModel) DeleteMany(ctx context.Context, ids []int64, userId int64) ([]int64, error) {
+	query := `
+	DELETE FROM todos
+	WHERE id = ANY($1) AND user_id = $2
+	RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{ids, userId}
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := []int64{}
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		deleted = append(deleted, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// SetAllCompleted marks every todo the user owns as completed or not and
+// returns the ids of the todos that changed. Todos shared with the user are
+// left alone.
+func (t *TodosModel) SetAllCompleted(ctx context.Context, userId int64, completed bool) ([]int64, error) {
 	query := `
 	UPDATE todos
-	SET title = $1, description = $2, due_date = $3, is_completed = $4
-	WHERE id = $5 AND user_id = $6
+	SET is_completed = $2, version = version + 1,
+	    completed_at = CASE WHEN $2 THEN NOW() END
+	WHERE user_id = $1 AND is_completed <> $2
 	RETURNING id
 	`
 
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{userId, completed}
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (t *TodosModel) Update(ctx context.Context, userId int64, todo *Todo) error {
+	query := `
+	UPDATE todos
+	SET title = $1, description = $2, due_date = $3, is_completed = $4, recurrence = $5, project_id = $6, version = version + 1,
+	    completed_at = CASE WHEN $4 THEN COALESCE(completed_at, NOW()) END
+	WHERE id = $7 AND user_id = $8 AND version = $9
+	RETURNING version
+	`
+
 	args := []any{
 		todo.Title,
 		todo.Description,
 		todo.DueDate,
 		todo.IsCompleted,
+		todo.Recurrence,
+		todo.ProjectID,
 		todo.ID,
 		userId,
+		todo.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	err := t.DB.QueryRow(ctx, query, args...).Scan(&todo.ID)
+	err := t.DB.QueryRow(ctx, query, args...).Scan(&todo.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		}
+		return constraintError(err)
+	}
+
+	return nil
+}
+
+func (t *TodosModel) Share(ctx context.Context, todoId int64, ownerId int64, targetUserId int64) error {
+	query := `
+	INSERT INTO todo_shares (todo_id, user_id)
+	SELECT id, $3
+	FROM todos
+	WHERE id = $1 AND user_id = $2
+	ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{todoId, ownerId, targetUserId}
+
+	_, err := t.DB.Exec(ctx, query, args...)
+	return err
+}
+
+func (t *TodosModel) Unshare(ctx context.Context, todoId int64, ownerId int64, targetUserId int64) error {
+	query := `
+	DELETE FROM todo_shares
+	USING todos
+	WHERE todo_shares.todo_id = todos.id
+	AND todos.id = $1
+	AND todos.user_id = $2
+	AND todo_shares.user_id = $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{todoId, ownerId, targetUserId}
+
+	result, err := t.DB.Exec(ctx, query, args...)
+	if err != nil {
 		return err
 	}
 
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
 }
 
-func ValidateTodo(v *validator.Validator, todo *Todo) {
-	v.Check(todo.Title != "", "title", "must be provided")
-	v.Check(len(todo.Title) <= 500, "title", "must not have more than 500 characters long")
+// duplicateSuffix marks the title of a todo's copy.
+const duplicateSuffix = " (copy)"
+
+// Duplicate copies one of the user's todos, along with its tags and subtasks,
+// into a new uncompleted todo at the end of their manual order. The copy's
+// title is shortened as needed to fit the suffix within maxTitleLength.
+func (t *TodosModel) Duplicate(ctx context.Context, id int64, userId int64, maxTitleLength int) (*Todo, error) {
+	query := `
+	INSERT INTO todos (title, description, due_date, is_completed, recurrence, user_id, project_id, position)
+	SELECT left(title, $3) || $4, description, due_date, false, recurrence, user_id, project_id,
+	    (SELECT COALESCE(max(position) + 1, 0) FROM todos WHERE user_id = $2)
+	FROM todos
+	WHERE id = $1 AND user_id = $2
+	RETURNING id
+	`
+
+	tagsQuery := `
+	INSERT INTO todo_tags (todo_id, tag_id)
+	SELECT $2, tag_id
+	FROM todo_tags
+	WHERE todo_id = $1
+	`
+
+	subtasksQuery := `
+	INSERT INTO subtasks (todo_id, title, is_completed, position)
+	SELECT $2, title, false, position
+	FROM subtasks
+	WHERE todo_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := t.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	titleLength := max(maxTitleLength-utf8.RuneCountInString(duplicateSuffix), 0)
+
+	var copyId int64
+
+	err = tx.QueryRow(ctx, query, id, userId, titleLength, duplicateSuffix).Scan(&copyId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(ctx, tagsQuery, id, copyId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, subtasksQuery, id, copyId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Get(ctx, copyId, userId)
+}
+
+// Reorder moves the listed todos to the front of the user's manual order, in
+// the order given, followed by the rest of their todos in their current order.
+// Positions are renumbered from 0 so there are never gaps, and ids that don't
+// belong to the user are ignored. It returns the number of todos whose
+// position changed.
+func (t *TodosModel) Reorder(ctx context.Context, userId int64, ids []int64) (int64, error) {
+	query := `
+	UPDATE todos
+	SET position = ordered.position, version = version + 1
+	FROM (
+	    SELECT todos.id, row_number() OVER (
+	        ORDER BY requested.ord NULLS LAST, todos.position, todos.id
+	    ) - 1 AS position
+	    FROM todos
+	    LEFT JOIN unnest($2::bigint[]) WITH ORDINALITY AS requested(id, ord) ON requested.id = todos.id
+	    WHERE todos.user_id = $1
+	) AS ordered
+	WHERE todos.id = ordered.id AND todos.user_id = $1 AND todos.position <> ordered.position
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{userId, ids}
+
+	result, err := t.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// CountForUser returns how many active, that is not completed, todos the user
+// owns.
+func (t *TodosModel) CountForUser(ctx context.Context, userId int64) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM todos
+	WHERE user_id = $1 AND NOT is_completed
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var count int
+
+	err := t.DB.QueryRow(ctx, query, userId).Scan(&count)
+	return count, err
+}
+
+func (t *TodosModel) Stats(ctx context.Context, userId int64) (*TodoStats, error) {
+	query := `
+	SELECT
+	    count(*),
+	    count(*) FILTER (WHERE is_completed),
+	    count(*) FILTER (WHERE NOT is_completed),
+	    count(*) FILTER (WHERE NOT is_completed AND due_date < NOW())
+	FROM todos
+	WHERE user_id = $1
+	`
+
+	var stats TodoStats
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := t.DB.QueryRow(ctx, query, userId).Scan(&stats.Total, &stats.Completed, &stats.Pending, &stats.Overdue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (t *TodosModel) Suggest(ctx context.Context, userId int64, prefix string, limit int) ([]string, error) {
+	query := `
+	SELECT DISTINCT title
+	FROM todos
+	WHERE user_id = $1 AND title ILIKE $2 || '%'
+	ORDER BY title
+	LIMIT $3
+	`
+
+	escaper := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{userId, escaper.Replace(prefix), limit}
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := []string{}
+	for rows.Next() {
+		var title string
+
+		err := rows.Scan(&title)
+		if err != nil {
+			return nil, err
+		}
+
+		titles = append(titles, title)
+	}
+
+	return titles, rows.Err()
+}
+
+// DueSoon returns the user's open todos that are due between now and now+within,
+// soonest first.
+func (t *TodosModel) DueSoon(ctx context.Context, userId int64, within time.Duration) ([]*Todo, error) {
+	query := `
+	SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+	    ARRAY(
+	        SELECT tags.name
+	        FROM todo_tags
+	        INNER JOIN tags ON tags.id = todo_tags.tag_id
+	        WHERE todo_tags.todo_id = todos.id
+	        ORDER BY tags.name
+	    ),
+	    ` + subtasksJSON + `,
+	    ` + attachmentsJSON + `
+	FROM todos
+	WHERE user_id = $1
+	AND is_completed = false
+	AND due_date BETWEEN $2 AND $3
+	ORDER BY due_date ASC, id ASC
+	`
+
+	now := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{userId, now, now.Add(within)}
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []*Todo{}
+
+	for rows.Next() {
+		var todo Todo
+
+		err := rows.Scan(
+			&todo.ID,
+			&todo.CreatedAt,
+			&todo.Title,
+			&todo.Description,
+			&todo.DueDate,
+			&todo.IsCompleted,
+			&todo.Recurrence,
+			&todo.ProjectID,
+			&todo.Position,
+			&todo.Version,
+			&todo.Tags,
+			&todo.Subtasks,
+			&todo.Attachments,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		todos = append(todos, &todo)
+	}
+
+	return todos, rows.Err()
+}
+
+// CompletedBetween returns the user's todos completed within [from, to], in the
+// order they were completed.
+func (t *TodosModel) CompletedBetween(ctx context.Context, userId int64, from, to time.Time) ([]*Todo, error) {
+	query := `
+	SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+	    ARRAY(
+	        SELECT tags.name
+	        FROM todo_tags
+	        INNER JOIN tags ON tags.id = todo_tags.tag_id
+	        WHERE todo_tags.todo_id = todos.id
+	        ORDER BY tags.name
+	    ),
+	    ` + subtasksJSON + `,
+	    ` + attachmentsJSON + `
+	FROM todos
+	WHERE user_id = $1
+	AND is_completed = true
+	AND completed_at BETWEEN $2 AND $3
+	ORDER BY completed_at ASC, id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	args := []any{userId, from, to}
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []*Todo{}
+
+	for rows.Next() {
+		var todo Todo
+
+		err := rows.Scan(
+			&todo.ID,
+			&todo.CreatedAt,
+			&todo.Title,
+			&todo.Description,
+			&todo.DueDate,
+			&todo.IsCompleted,
+			&todo.Recurrence,
+			&todo.ProjectID,
+			&todo.Position,
+			&todo.Version,
+			&todo.Tags,
+			&todo.Subtasks,
+			&todo.Attachments,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		todos = append(todos, &todo)
+	}
+
+	return todos, rows.Err()
+}
+
+// Overdue returns a page of the user's open todos whose due date has passed,
+// the most overdue first. Todos without a due date are never overdue.
+func (t *TodosModel) Overdue(ctx context.Context, userId int64, filters Filters) ([]*Todo, Metadata, error) {
+	countQuery := `
+	SELECT count(*)
+	FROM todos
+	WHERE user_id = $1 AND is_completed = false AND due_date < $2
+	`
+
+	query := `
+	SELECT id, created_at, title, description, due_date, is_completed, recurrence, project_id, position, version,
+	    ARRAY(
+	        SELECT tags.name
+	        FROM todo_tags
+	        INNER JOIN tags ON tags.id = todo_tags.tag_id
+	        WHERE todo_tags.todo_id = todos.id
+	        ORDER BY tags.name
+	    ),
+	    ` + subtasksJSON + `,
+	    ` + attachmentsJSON + `
+	FROM todos
+	WHERE user_id = $1 AND is_completed = false AND due_date < $2
+	ORDER BY due_date ASC, id ASC
+	LIMIT $3 OFFSET $4
+	`
+
+	now := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var totalRecords int
+
+	err := t.DB.QueryRow(ctx, countQuery, userId, now).Scan(&totalRecords)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	args := []any{userId, now, filters.limit(), filters.offset()}
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	todos := []*Todo{}
+
+	for rows.Next() {
+		var todo Todo
+
+		err := rows.Scan(
+			&todo.ID,
+			&todo.CreatedAt,
+			&todo.Title,
+			&todo.Description,
+			&todo.DueDate,
+			&todo.IsCompleted,
+			&todo.Recurrence,
+			&todo.ProjectID,
+			&todo.Position,
+			&todo.Version,
+			&todo.Tags,
+			&todo.Subtasks,
+			&todo.Attachments,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		todos = append(todos, &todo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return todos, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (t *TodosModel) InsertNextOccurrence(ctx context.Context, userId int64, todo *Todo) (*Todo, error) {
+	dueDate := time.Now()
+	if todo.DueDate != nil {
+		dueDate = *todo.DueDate
+	}
+
+	switch todo.Recurrence {
+	case RecurrenceDaily:
+		dueDate = dueDate.AddDate(0, 0, 1)
+	case RecurrenceWeekly:
+		dueDate = dueDate.AddDate(0, 0, 7)
+	case RecurrenceMonthly:
+		dueDate = dueDate.AddDate(0, 1, 0)
+	default:
+		return nil, nil
+	}
+
+	next := &Todo{
+		Title:       todo.Title,
+		Description: todo.Description,
+		DueDate:     &dueDate,
+		IsCompleted: false,
+		Recurrence:  todo.Recurrence,
+		ProjectID:   todo.ProjectID,
+		Tags:        todo.Tags,
+		Subtasks:    []Subtask{},
+		Attachments: []Attachment{},
+	}
+
+	err := t.Insert(ctx, userId, next)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.AddTags(ctx, next.ID, userId, next.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+func ValidateDueDate(v *validator.Validator, dueDate *time.Time, allowPastDueDate bool) {
+	if dueDate == nil {
+		return
+	}
+
+	v.Check(!dueDate.IsZero(), "due_date", "must be a valid date")
+
+	if !allowPastDueDate {
+		v.Check(!dueDate.Before(time.Now()), "due_date", "must not be in the past")
+	}
+}
+
+func ValidateTodoOrder(v *validator.Validator, ids []int64) {
+	v.Check(len(ids) > 0, "ids", "must contain at least one id")
+	v.Check(len(ids) <= 1000, "ids", "must not contain more than 1000 ids")
+
+	seen := make(map[int64]bool, len(ids))
+
+	for _, id := range ids {
+		v.Check(!seen[id], "ids", "must not contain duplicate values")
+		seen[id] = true
+	}
+}
+
+func ValidateDescription(v *validator.Validator, description string, maxLength int) {
+	v.Check(utf8.RuneCountInString(description) <= maxLength, "description", fmt.Sprintf("must not be more than %d characters long", maxLength))
+}
+
+// MaxSearchLength bounds the search term handed to plainto_tsquery, which
+// gets more expensive the longer the term.
+const MaxSearchLength = 500
+
+func ValidateSearch(v *validator.Validator, search string) {
+	v.Check(utf8.RuneCountInString(search) <= MaxSearchLength, "search", fmt.Sprintf("must not be more than %d characters long", MaxSearchLength))
+}
+
+// ValidateTodoOptions holds the limits ValidateTodo checks a todo against.
+type ValidateTodoOptions struct {
+	MaxTitleLength       int
+	MaxDescriptionLength int
+	RequireDueDate       bool
+	AllowPastDueDate     bool
+}
+
+// DefaultValidateTodoOptions returns the limits used unless a deployment
+// configures its own.
+func DefaultValidateTodoOptions() ValidateTodoOptions {
+	return ValidateTodoOptions{
+		MaxTitleLength:       MaxTitleLength,
+		MaxDescriptionLength: MaxDescriptionLength,
+	}
+}
+
+func ValidateTodo(v *validator.Validator, todo *Todo, opts ValidateTodoOptions) {
+	v.Check(strings.TrimSpace(todo.Title) != "", "title", "must be provided")
+	v.Check(utf8.RuneCountInString(todo.Title) <= opts.MaxTitleLength, "title", fmt.Sprintf("must not be more than %d characters long", opts.MaxTitleLength))
+	ValidateDescription(v, todo.Description, opts.MaxDescriptionLength)
+	v.Check(validator.PermittedValue(todo.Recurrence, RecurrenceSafeList...), "recurrence", fmt.Sprintf("must be one of the following: %v", RecurrenceSafeList))
+
+	if opts.RequireDueDate {
+		v.Check(todo.DueDate != nil, "due_date", "must be provided")
+	}
+
+	ValidateDueDate(v, todo.DueDate, opts.AllowPastDueDate)
 }
@@ -0,0 +1,164 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTodoDueDate(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		dueDate   *time.Time
+		allowPast bool
+		valid     bool
+	}{
+		{"none", nil, false, true},
+		{"zero", &time.Time{}, false, false},
+		{"zero with past dates allowed", &time.Time{}, true, false},
+		{"past", &past, false, false},
+		{"past with past dates allowed", &past, true, true},
+		{"future", &future, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultValidateTodoOptions()
+			opts.AllowPastDueDate = tt.allowPast
+
+			v := validator.New()
+
+			ValidateTodo(v, &Todo{Title: "Buy milk", DueDate: tt.dueDate, Recurrence: RecurrenceNone}, opts)
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateTodoDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		valid       bool
+	}{
+		{"empty", "", true},
+		{"at the limit", strings.Repeat("é", MaxDescriptionLength), true},
+		{"over the limit", strings.Repeat("a", MaxDescriptionLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateTodo(v, &Todo{Title: "Buy milk", Description: tt.description, Recurrence: RecurrenceNone}, DefaultValidateTodoOptions())
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateTodoTitle(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		valid bool
+	}{
+		{"title", "Buy milk", true},
+		{"empty", "", false},
+		{"spaces only", "   ", false},
+		{"whitespace only", "\t\n ", false},
+		{"at the limit", strings.Repeat("a", 500), true},
+		{"over the limit", strings.Repeat("a", 501), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateTodo(v, &Todo{Title: tt.title, Recurrence: RecurrenceNone}, DefaultValidateTodoOptions())
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateTodoOptions(t *testing.T) {
+	dueDate := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		todo  Todo
+		opts  ValidateTodoOptions
+		field string
+	}{
+		{"smaller title max", Todo{Title: "Buy milk and bread"}, ValidateTodoOptions{MaxTitleLength: 10, MaxDescriptionLength: MaxDescriptionLength}, "title"},
+		{"smaller description max", Todo{Title: "Buy milk", Description: "Semi-skimmed"}, ValidateTodoOptions{MaxTitleLength: 500, MaxDescriptionLength: 5}, "description"},
+		{"due date required", Todo{Title: "Buy milk"}, ValidateTodoOptions{MaxTitleLength: 500, MaxDescriptionLength: MaxDescriptionLength, RequireDueDate: true}, "due_date"},
+		{"due date required and given", Todo{Title: "Buy milk", DueDate: &dueDate}, ValidateTodoOptions{MaxTitleLength: 500, MaxDescriptionLength: MaxDescriptionLength, RequireDueDate: true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.todo.Recurrence = RecurrenceNone
+
+			v := validator.New()
+
+			ValidateTodo(v, &tt.todo, DefaultValidateTodoOptions())
+
+			if !v.Valid() {
+				t.Fatalf("default options: got errors %v; want valid", v.Errors)
+			}
+
+			v = validator.New()
+
+			ValidateTodo(v, &tt.todo, tt.opts)
+
+			if tt.field == "" {
+				if !v.Valid() {
+					t.Errorf("got errors %v; want valid", v.Errors)
+				}
+				return
+			}
+
+			if len(v.Errors) != 1 || v.Errors[tt.field] == "" {
+				t.Errorf("got errors %v; want one for %s", v.Errors, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidateSearch(t *testing.T) {
+	tests := []struct {
+		name   string
+		search string
+		valid  bool
+	}{
+		{"empty", "", true},
+		{"term", "milk", true},
+		{"at the limit", strings.Repeat("a", MaxSearchLength), true},
+		{"over the limit", strings.Repeat("a", MaxSearchLength+1), false},
+		{"multi-byte characters at the limit", strings.Repeat("é", MaxSearchLength), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateSearch(v, tt.search)
+
+			if v.Valid() != tt.valid {
+				t.Errorf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// tokenCache is a small LRU cache of the users that tokens resolve to, so that
+// authenticated requests don't all have to hit the database. Entries expire
+// after the cache TTL or when the token itself expires, whichever is sooner.
+type tokenCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type tokenCacheEntry struct {
+	key     string
+	user    User
+	expires time.Time
+}
+
+// tokens is the cache used by TokensModel. It's nil, and caching disabled,
+// until SetTokenCache is called.
+var tokens *tokenCache
+
+func SetTokenCache(size int, ttl time.Duration) error {
+	if size < 0 {
+		return errors.New("token cache size must not be negative")
+	}
+
+	if size == 0 {
+		tokens = nil
+		return nil
+	}
+
+	if ttl <= 0 {
+		return errors.New("token cache ttl must be a positive duration")
+	}
+
+	tokens = &tokenCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	return nil
+}
+
+func (c *tokenCache) get(key string) (*User, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*tokenCacheEntry)
+
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	user := entry.user
+	return &user, true
+}
+
+func (c *tokenCache) set(key string, user *User, tokenExpiry time.Time) {
+	if c == nil {
+		return
+	}
+
+	expires := time.Now().Add(c.ttl)
+	if tokenExpiry.Before(expires) {
+		expires = tokenExpiry
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&tokenCacheEntry{key: key, user: *user, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *tokenCache) evict(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// evictUser drops every cached token belonging to the user, for changes that
+// can't be traced back to a single token.
+func (c *tokenCache) evictUser(userID int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, element := range c.entries {
+		if element.Value.(*tokenCacheEntry).user.Id == userID {
+			c.remove(element)
+		}
+	}
+}
+
+func (c *tokenCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*tokenCacheEntry).key)
+}
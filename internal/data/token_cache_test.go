@@ -0,0 +1,274 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// stubDB is a DBTX whose QueryRow answers with queryRow and counts its calls.
+// Its other methods aren't implemented.
+type stubDB struct {
+	DBTX
+	calls    int
+	queryRow func(sql string) pgx.Row
+}
+
+func (db *stubDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	db.calls++
+	return db.queryRow(sql)
+}
+
+// stubRow scans values into the destinations in order, or returns err.
+type stubRow struct {
+	values []any
+	err    error
+}
+
+func (r stubRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+
+	return nil
+}
+
+// enableTokenCache turns the token cache on until the test ends.
+func enableTokenCache(t *testing.T, size int, ttl time.Duration) {
+	t.Helper()
+
+	err := SetTokenCache(size, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { SetTokenCache(0, 0) })
+}
+
+// userRow is the row GetForToken scans for a token expiring at expiry.
+func userRow(expiry time.Time) stubRow {
+	return stubRow{values: []any{int64(1), time.Now(), "Alice", "alice@example.com", []byte("hash"), "", false, RoleUser, expiry}}
+}
+
+func TestGetForTokenCache(t *testing.T) {
+	enableTokenCache(t, 10, time.Minute)
+
+	revoked := false
+
+	db := &stubDB{queryRow: func(sql string) pgx.Row {
+		switch {
+		case strings.Contains(sql, "DELETE"):
+			revoked = true
+			return stubRow{values: []any{"session"}}
+		case revoked:
+			return stubRow{err: pgx.ErrNoRows}
+		default:
+			return userRow(time.Now().Add(time.Hour))
+		}
+	}}
+
+	model := TokensModel{DB: db}
+	ctx := context.Background()
+
+	for range 3 {
+		user, err := model.GetForToken(ctx, ScopeAuthentication, "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if user.Id != 1 {
+			t.Errorf("got user %d; want 1", user.Id)
+		}
+	}
+
+	if db.calls != 1 {
+		t.Errorf("repeated hits: got %d queries; want 1", db.calls)
+	}
+
+	_, err := model.Delete(ctx, ScopeAuthentication, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = model.GetForToken(ctx, ScopeAuthentication, "token")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("revoked token: got error %v; want %v", err, ErrRecordNotFound)
+	}
+}
+
+// stubTx is a transaction on a stubDB whose deletes only take effect, by
+// calling commit, once it commits. Its other methods aren't implemented.
+type stubTx struct {
+	pgx.Tx
+	db     *stubDB
+	commit func()
+}
+
+func (tx *stubTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.NewCommandTag("DELETE 1"), nil
+}
+
+func (tx *stubTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+func (tx *stubTx) Commit(ctx context.Context) error {
+	tx.commit()
+	return nil
+}
+
+func (tx *stubTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+// txDB is a stubDB that begins tx.
+type txDB struct {
+	*stubDB
+	tx *stubTx
+}
+
+func (db txDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return db.tx, nil
+}
+
+func TestGetForTokenCacheRevokedInTx(t *testing.T) {
+	errRollback := errors.New("rollback")
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{"commit", nil, ErrRecordNotFound},
+		{"rollback", errRollback, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enableTokenCache(t, 10, time.Minute)
+
+			revoked := false
+
+			db := &stubDB{queryRow: func(sql string) pgx.Row {
+				if revoked {
+					return stubRow{err: pgx.ErrNoRows}
+				}
+
+				return userRow(time.Now().Add(time.Hour))
+			}}
+
+			models := NewModels(txDB{stubDB: db, tx: &stubTx{db: db, commit: func() { revoked = true }}})
+			ctx := context.Background()
+
+			_, err := models.Tokens.GetForToken(ctx, ScopeAuthentication, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = models.WithTx(ctx, func(tx Models) error {
+				_, err := tx.Tokens.DeleteAllForUser(ctx, ScopeAuthentication, 1)
+				if err != nil {
+					return err
+				}
+
+				// Another request looks the token up before the delete
+				// commits, and must not cache it again for after it.
+				_, err = models.Tokens.GetForToken(ctx, ScopeAuthentication, "token")
+				if err != nil {
+					t.Errorf("lookup during the transaction: got error %v", err)
+				}
+
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v; want %v", err, tt.err)
+			}
+
+			_, err = models.Tokens.GetForToken(ctx, ScopeAuthentication, "token")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("lookup after the transaction: got error %v; want %v", err, tt.wantErr)
+			}
+
+			if tt.err != nil && db.calls != 1 {
+				t.Errorf("got %d queries; want 1, as a rolled back revocation mustn't evict the token", db.calls)
+			}
+		})
+	}
+}
+
+func TestGetForTokenCacheTokenExpiry(t *testing.T) {
+	enableTokenCache(t, 10, time.Minute)
+
+	db := &stubDB{queryRow: func(sql string) pgx.Row {
+		return userRow(time.Now().Add(50 * time.Millisecond))
+	}}
+
+	model := TokensModel{DB: db}
+	ctx := context.Background()
+
+	for range 2 {
+		_, err := model.GetForToken(ctx, ScopeAuthentication, "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := model.GetForToken(ctx, ScopeAuthentication, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if db.calls != 2 {
+		t.Errorf("got %d queries; want 2, as the entry mustn't outlive the token", db.calls)
+	}
+}
+
+func TestTokenCacheSize(t *testing.T) {
+	enableTokenCache(t, 2, time.Minute)
+
+	expiry := time.Now().Add(time.Hour)
+
+	for i, key := range []string{"a", "b", "c"} {
+		tokens.set(key, &User{Id: int64(i + 1)}, expiry)
+	}
+
+	if _, ok := tokens.get("a"); ok {
+		t.Error("the least recently used entry wasn't evicted")
+	}
+
+	for _, key := range []string{"b", "c"} {
+		if _, ok := tokens.get(key); !ok {
+			t.Errorf("entry %q was evicted", key)
+		}
+	}
+
+	tokens.evictUser(2)
+
+	if _, ok := tokens.get("b"); ok {
+		t.Error("the user's entry wasn't evicted")
+	}
+}
+
+func TestSetTokenCache(t *testing.T) {
+	t.Cleanup(func() { SetTokenCache(0, 0) })
+
+	if err := SetTokenCache(-1, time.Minute); err == nil {
+		t.Error("negative size: got no error")
+	}
+
+	if err := SetTokenCache(10, 0); err == nil {
+		t.Error("zero ttl: got no error")
+	}
+}
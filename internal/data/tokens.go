@@ -7,26 +7,44 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"encoding/hex"
 	"errors"
 	"time"
-
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
 	ScopeAuthentication = "Authentication"
+	ScopeRefresh        = "Refresh"
+	ScopeEmailChange    = "EmailChange"
+	ScopeCalendar       = "Calendar"
 )
 
+const sessionIDLength = 16
+
+// sessionScopes are the scopes of the tokens that make up a session.
+var sessionScopes = []string{ScopeAuthentication, ScopeRefresh}
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	Email     string    `json:"-"`
+	SessionID string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Session struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Expiry    time.Time `json:"expiry"`
+	Current   bool      `json:"current"`
 }
 
 type TokensModel struct {
-	DB *pgxpool.Pool
+	DB    DBTX
+	hooks *commitHooks
 }
 
 func ValidateTokenPlainText(v *validator.Validator, tokenPlaintext string) {
@@ -54,40 +72,67 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	return token, nil
 }
 
-func (t *TokensModel) Insert(token *Token) error {
+// NewSessionID returns a random id for a new session. A session is the
+// authentication and refresh token pair issued on sign-in, and keeps its id
+// as the pair is rotated, so it can be listed and revoked as a whole.
+func NewSessionID() (string, error) {
+	randomBytes := make([]byte, sessionIDLength/2)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(randomBytes), nil
+}
+
+func tokenCacheKey(scope string, hash []byte) string {
+	return scope + ":" + string(hash)
+}
+
+func (t *TokensModel) Insert(ctx context.Context, token *Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO tokens (hash, user_id, expiry, scope, email, session_id)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING created_at
 	`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Email, token.SessionID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	_, err := t.DB.Exec(ctx, query, args...)
-	return err
+	return t.DB.QueryRow(ctx, query, args...).Scan(&token.CreatedAt)
 }
 
-func (t *TokensModel) GetForToken(tokenPlaintext string) (*User, error) {
+func (t *TokensModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
 	query := `
-	SELECT users.id, users.created_at, users.email, users.password_hash
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.totp_secret, users.totp_enabled, users.role, tokens.expiry
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
 	WHERE tokens.hash = $1
-	AND tokens.expiry > $2
+	AND tokens.scope = $2
+	AND tokens.expiry > $3
 	`
 
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
-	args := []any{tokenHash[:], time.Now()}
+
+	cacheKey := tokenCacheKey(tokenScope, tokenHash[:])
+	if user, ok := tokens.get(cacheKey); ok {
+		return user, nil
+	}
+
+	args := []any{tokenHash[:], tokenScope, time.Now()}
 
 	var user User
+	var expiry time.Time
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	err := t.DB.QueryRow(ctx, query, args...).Scan(&user.Id, &user.CreatedAt, &user.Email, &user.Password.hash)
+	err := retryRead(ctx, func() error {
+		return t.DB.QueryRow(ctx, query, args...).Scan(&user.Id, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.TOTPSecret, &user.TOTPEnabled, &user.Role, &expiry)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -97,15 +142,221 @@ func (t *TokensModel) GetForToken(tokenPlaintext string) (*User, error) {
 		}
 	}
 
+	tokens.set(cacheKey, &user, expiry)
+
 	return &user, nil
 }
 
-func (t *TokensModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (t *TokensModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Insert(ctx, token)
+	return token, err
+}
+
+// NewForSession issues a token that belongs to the given session.
+func (t *TokensModel) NewForSession(ctx context.Context, userID int64, ttl time.Duration, scope string, sessionID string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	err = t.Insert(token)
+	token.SessionID = sessionID
+
+	err = t.Insert(ctx, token)
+	return token, err
+}
+
+// SessionIDForToken returns the session an unexpired token belongs to.
+func (t *TokensModel) SessionIDForToken(ctx context.Context, tokenScope, tokenPlaintext string) (string, error) {
+	query := `
+	SELECT session_id
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3
+	`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	args := []any{tokenHash[:], tokenScope, time.Now()}
+
+	var sessionID string
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := t.DB.QueryRow(ctx, query, args...).Scan(&sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return sessionID, nil
+}
+
+// NewEmailChange issues a token that, once redeemed, moves the user over to
+// the new email address.
+func (t *TokensModel) NewEmailChange(ctx context.Context, userID int64, email string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Email = NormalizeEmail(email)
+
+	err = t.Insert(ctx, token)
 	return token, err
 }
+
+// GetEmailChange returns the user and new email address for an unexpired email
+// change token.
+func (t *TokensModel) GetEmailChange(ctx context.Context, tokenPlaintext string) (int64, string, error) {
+	query := `
+	SELECT user_id, email
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3
+	`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	args := []any{tokenHash[:], ScopeEmailChange, time.Now()}
+
+	var userID int64
+	var email string
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := t.DB.QueryRow(ctx, query, args...).Scan(&userID, &email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, "", ErrRecordNotFound
+		default:
+			return 0, "", err
+		}
+	}
+
+	return userID, email, nil
+}
+
+// DeleteAllForUser deletes every token of the given scope belonging to the
+// user and returns how many were deleted.
+func (t *TokensModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) (int64, error) {
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := t.DB.Exec(ctx, query, scope, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	t.hooks.afterCommit(func() { tokens.evictUser(userID) })
+
+	return result.RowsAffected(), nil
+}
+
+// Delete deletes the token and returns the session it belonged to.
+func (t *TokensModel) Delete(ctx context.Context, tokenScope, tokenPlaintext string) (string, error) {
+	query := `
+	DELETE FROM tokens
+	WHERE hash = $1 AND scope = $2
+	RETURNING session_id
+	`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	args := []any{tokenHash[:], tokenScope}
+
+	var sessionID string
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := t.DB.QueryRow(ctx, query, args...).Scan(&sessionID)
+
+	t.hooks.afterCommit(func() { tokens.evict(tokenCacheKey(tokenScope, tokenHash[:])) })
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return sessionID, nil
+}
+
+// GetSessionsForUser lists the user's sessions that can still be refreshed or
+// used. A session's expiry is that of its longest lived token.
+func (t *TokensModel) GetSessionsForUser(ctx context.Context, userID int64) ([]*Session, error) {
+	query := `
+	SELECT session_id, min(created_at), max(expiry)
+	FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2) AND session_id <> '' AND expiry > $3
+	GROUP BY session_id
+	ORDER BY min(created_at) DESC, session_id
+	`
+
+	args := []any{userID, sessionScopes, time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := t.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(&session.ID, &session.CreatedAt, &session.Expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes a session by deleting its authentication and refresh
+// tokens together, so the session can't be refreshed back to life.
+func (t *TokensModel) DeleteSession(ctx context.Context, userID int64, sessionID string) error {
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2) AND session_id = $3
+	`
+
+	args := []any{userID, sessionScopes, sessionID}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := t.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	t.hooks.afterCommit(func() { tokens.evictUser(userID) })
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
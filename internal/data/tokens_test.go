@@ -0,0 +1,94 @@
+package data
+
+import (
+	"GoTodo/internal/testdb"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func insertTestUser(t *testing.T, models Models) *User {
+	t.Helper()
+
+	user := &User{Name: "Test User", Email: "alice@example.com"}
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestGetForTokenExpiry(t *testing.T) {
+	models := NewModels(testdb.New(t))
+	user := insertTestUser(t, models)
+
+	ctx := context.Background()
+
+	token, err := models.Tokens.New(ctx, user.Id, time.Second, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := models.Tokens.GetForToken(ctx, ScopeAuthentication, token.Plaintext)
+	if err != nil {
+		t.Fatalf("valid token: got error %v", err)
+	}
+
+	if got.Id != user.Id {
+		t.Errorf("valid token: got user %d; want %d", got.Id, user.Id)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	_, err = models.Tokens.GetForToken(ctx, ScopeAuthentication, token.Plaintext)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expired token: got error %v; want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestTokenCreatedAt(t *testing.T) {
+	models := NewModels(testdb.New(t))
+	user := insertTestUser(t, models)
+
+	ctx := context.Background()
+
+	sessionID, err := NewSessionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := models.Tokens.NewForSession(ctx, user.Id, time.Hour, ScopeAuthentication, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Allow for the database's clock differing a little from ours.
+	recent := func(createdAt time.Time) bool {
+		return time.Since(createdAt).Abs() < time.Minute
+	}
+
+	if !recent(token.CreatedAt) {
+		t.Errorf("got created_at %v; want about now", token.CreatedAt)
+	}
+
+	sessions, err := models.Tokens.GetSessionsForUser(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 1 || sessions[0].ID != sessionID {
+		t.Fatalf("got sessions %v; want the one session", sessions)
+	}
+
+	if !recent(sessions[0].CreatedAt) {
+		t.Errorf("got session created_at %v; want about now", sessions[0].CreatedAt)
+	}
+}
@@ -5,32 +5,88 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
 	"time"
 	"unicode/utf8"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var ErrDuplicateEmail = errors.New("duplicate email")
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var bcryptCost = 12
+
+func SetBcryptCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	bcryptCost = cost
+
+	return nil
+}
+
+var strictEmailValidation = false
+
+// SetStrictEmailValidation turns on validating emails with net/mail on top of
+// EmailRX.
+func SetStrictEmailValidation(strict bool) {
+	strictEmailValidation = strict
+}
+
 type UsersModel struct {
-	DB *pgxpool.Pool
+	DB    DBTX
+	hooks *commitHooks
+}
+
+func (u *UsersModel) Get(ctx context.Context, id int64) (*User, error) {
+	query := `
+	SELECT id, created_at, name, email, password_hash, totp_secret, totp_enabled, role
+	FROM users
+	WHERE id = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := retryRead(ctx, func() error {
+		return u.DB.QueryRow(ctx, query, id).Scan(&user.Id, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.TOTPSecret, &user.TOTPEnabled, &user.Role)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
 }
 
-func (u *UsersModel) GetByEmail(email string) (*User, error) {
+func (u *UsersModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-	SELECT id, created_at, name, email, password_hash
+	SELECT id, created_at, name, email, password_hash, totp_secret, totp_enabled, role
 	FROM users
-	WHERE email = $1
+	WHERE lower(email) = $1
 	`
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	err := u.DB.QueryRow(ctx, query, email).Scan(&user.Id, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash)
+	err := u.DB.QueryRow(ctx, query, NormalizeEmail(email)).Scan(&user.Id, &user.CreatedAt, &user.Name, &user.Email, &user.Password.hash, &user.TOTPSecret, &user.TOTPEnabled, &user.Role)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -43,21 +99,25 @@ func (u *UsersModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (u *UsersModel) Insert(user *User) error {
+func (u *UsersModel) Insert(ctx context.Context, user *User) error {
 	query := `
 	INSERT INTO users (name, email, password_hash)
 	VALUES ($1, $2, $3)
-	RETURNING id, created_at`
+	RETURNING id, created_at, role`
+
+	user.Email = NormalizeEmail(user.Email)
 
 	args := []any{user.Name, user.Email, user.Password.hash}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	err := u.DB.QueryRow(ctx, query, args...).Scan(&user.Id, &user.CreatedAt)
+	err := u.DB.QueryRow(ctx, query, args...).Scan(&user.Id, &user.CreatedAt, &user.Role)
 	if err != nil {
+		var pgErr *pgconn.PgError
+
 		switch {
-		case err.Error() == `ERROR: duplicate key value violates unique constraint "users_email_key" (SQLSTATE 23505)`:
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && (pgErr.ConstraintName == "users_email_key" || pgErr.ConstraintName == "users_email_lower_idx"):
 			return ErrDuplicateEmail
 		default:
 			return err
@@ -67,13 +127,223 @@ func (u *UsersModel) Insert(user *User) error {
 	return nil
 }
 
+func (u *UsersModel) GetAll(ctx context.Context, filters Filters) ([]*User, Metadata, error) {
+	orderBy, err := filters.orderBy()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	countQuery := `
+	SELECT count(*)
+	FROM users
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var totalRecords int
+
+	err = u.DB.QueryRow(ctx, countQuery).Scan(&totalRecords)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+	SELECT id, created_at, name, email, totp_enabled, role
+	FROM users
+	ORDER BY %s
+	LIMIT $1 OFFSET $2
+	`, orderBy)
+
+	args := []any{filters.limit(), filters.offset()}
+
+	rows, err := u.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(&user.Id, &user.CreatedAt, &user.Name, &user.Email, &user.TOTPEnabled, &user.Role)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return users, metadata, nil
+}
+
+// Update saves the user's profile. The email address isn't included; changing
+// it has to go through UpdateEmail once the new address is confirmed.
+func (u *UsersModel) Update(ctx context.Context, user *User) error {
+	query := `
+	UPDATE users
+	SET name = $1
+	WHERE id = $2
+	`
+
+	args := []any{user.Name, user.Id}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := u.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	u.hooks.afterCommit(func() { tokens.evictUser(user.Id) })
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (u *UsersModel) UpdateEmail(ctx context.Context, id int64, email string) error {
+	query := `
+	UPDATE users
+	SET email = $1
+	WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := u.DB.Exec(ctx, query, NormalizeEmail(email), id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+
+		switch {
+		case errors.As(err, &pgErr) && pgErr.Code == "23505" && (pgErr.ConstraintName == "users_email_key" || pgErr.ConstraintName == "users_email_lower_idx"):
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	u.hooks.afterCommit(func() { tokens.evictUser(id) })
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (u *UsersModel) Delete(ctx context.Context, id int64) error {
+	query := `
+	DELETE FROM users
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := u.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	u.hooks.afterCommit(func() { tokens.evictUser(id) })
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Lock takes a row lock on the user that's held until the transaction ends.
+// Checks on the user's rows that have to stay true until a write commits,
+// like the todo quota, take it first so concurrent requests run one at a time.
+// It doesn't block inserts referencing the user.
+func (u *UsersModel) Lock(ctx context.Context, id int64) error {
+	query := `
+	SELECT id
+	FROM users
+	WHERE id = $1
+	FOR NO KEY UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := u.DB.QueryRow(ctx, query, id).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *UsersModel) SetTOTPSecret(ctx context.Context, id int64, secret string) error {
+	query := `
+	UPDATE users
+	SET totp_secret = $1, totp_enabled = false
+	WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := u.DB.Exec(ctx, query, secret, id)
+	if err != nil {
+		return err
+	}
+
+	u.hooks.afterCommit(func() { tokens.evictUser(id) })
+
+	return nil
+}
+
+func (u *UsersModel) EnableTOTP(ctx context.Context, id int64) error {
+	query := `
+	UPDATE users
+	SET totp_enabled = true
+	WHERE id = $1 AND totp_secret <> ''
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := u.DB.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	u.hooks.afterCommit(func() { tokens.evictUser(id) })
+
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
 }
 
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), bcryptCost)
 	if err != nil {
 		return err
 	}
@@ -99,16 +369,42 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 }
 
 type User struct {
-	Id        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
+	Id          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Password    password  `json:"-"`
+	TOTPSecret  string    `json:"-"`
+	TOTPEnabled bool      `json:"totp_enabled"`
+	Role        string    `json:"role"`
+}
+
+// NormalizeEmail returns the form emails are stored and compared in, so that
+// addresses differing only in case belong to the same account.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
-	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+	v.Check(validEmail(email), "email", "must be a valid email address")
+}
+
+// validEmail checks email against EmailRX and, with strict email validation
+// on, also requires net/mail to parse it as a bare address.
+func validEmail(email string) bool {
+	if !validator.Matches(email, validator.EmailRX) {
+		return false
+	}
+
+	if !strictEmailValidation {
+		return true
+	}
+
+	// ParseAddress also accepts forms like "Name <user@example.com>", so the
+	// parsed address has to be the whole input.
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
 }
 
 func ValidatePasswordPlainText(v *validator.Validator, password string) {
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"GoTodo/internal/data/validator"
+	"GoTodo/internal/testdb"
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestInsertDuplicateEmail(t *testing.T) {
+	models := NewModels(testdb.New(t))
+	insertTestUser(t, models)
+
+	user := &User{Name: "Another User", Email: "ALICE@example.com"}
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Users.Insert(context.Background(), user)
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("got error %v; want %v", err, ErrDuplicateEmail)
+	}
+}
+
+func TestSetBcryptCost(t *testing.T) {
+	t.Cleanup(func() { bcryptCost = 12 })
+
+	for _, cost := range []int{bcrypt.MinCost - 1, bcrypt.MaxCost + 1} {
+		if err := SetBcryptCost(cost); err == nil {
+			t.Errorf("SetBcryptCost(%d): got no error", cost)
+		}
+	}
+
+	err := SetBcryptCost(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p password
+
+	err = p.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cost, err := bcrypt.Cost(p.hash); err != nil || cost != bcrypt.MinCost {
+		t.Errorf("got cost %d (error %v); want %d", cost, err, bcrypt.MinCost)
+	}
+
+	match, err := p.Matches("pa55word")
+	if err != nil || !match {
+		t.Errorf("got match %t (error %v); want true", match, err)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"alice@example.com", "alice@example.com"},
+		{"Alice@Example.COM", "alice@example.com"},
+		{" alice@example.com ", "alice@example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeEmail(tt.email); got != tt.want {
+			t.Errorf("NormalizeEmail(%q): got %q; want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		email  string
+		strict bool
+		valid  bool
+	}{
+		{"valid", "alice@example.com", false, true},
+		{"valid strict", "alice@example.com", true, true},
+		{"consecutive dots", "alice..bob@example.com", false, true},
+		{"consecutive dots strict", "alice..bob@example.com", true, false},
+		{"leading dot", ".alice@example.com", false, true},
+		{"leading dot strict", ".alice@example.com", true, false},
+		{"quoted local part", `"alice bob"@example.com`, false, false},
+		{"quoted local part strict", `"alice bob"@example.com`, true, false},
+		{"display name strict", "Alice <alice@example.com>", true, false},
+	}
+
+	t.Cleanup(func() { SetStrictEmailValidation(false) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetStrictEmailValidation(tt.strict)
+
+			v := validator.New()
+
+			ValidateEmail(v, tt.email)
+
+			if v.Valid() != tt.valid {
+				t.Fatalf("got errors %v; want valid %t", v.Errors, tt.valid)
+			}
+
+			if !tt.valid && v.Errors["email"] != "must be a valid email address" {
+				t.Errorf("got error %q; want %q", v.Errors["email"], "must be a valid email address")
+			}
+		})
+	}
+}
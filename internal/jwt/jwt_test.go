@@ -0,0 +1,57 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Unix(1_700_000_000, 0)
+
+	claims := Claims{Subject: "42", SessionID: "0123456789abcdef", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+
+	token, err := Sign(claims, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+
+	otherPayload, err := Sign(Claims{Subject: "1", ExpiresAt: claims.ExpiresAt}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  []byte
+		at      time.Time
+		wantErr error
+	}{
+		{"valid", token, secret, now, nil},
+		{"expired", token, secret, now.Add(time.Hour), ErrExpiredToken},
+		{"wrong secret", token, []byte("another secret"), now, ErrInvalidToken},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])), secret, now, ErrInvalidToken},
+		{"tampered payload", parts[0] + "." + strings.Split(otherPayload, ".")[1] + "." + parts[2], secret, now, ErrInvalidToken},
+		{"unsupported header", "eyJhbGciOiJub25lIn0." + parts[1] + "." + parts[2], secret, now, ErrInvalidToken},
+		{"malformed", "not-a-jwt", secret, now, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(tt.token, tt.secret, tt.at)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && got != claims {
+				t.Errorf("got claims %+v; want %+v", got, claims)
+			}
+		})
+	}
+}
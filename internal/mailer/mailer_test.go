@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	m := New("smtp.example.com", 587, "", "", "GoTodo <no-reply@gotodo.local>")
+
+	data := map[string]any{"name": "Alice", "token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}
+
+	msg, err := m.message("alice@example.org", "email_change.tmpl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := parsed.Header.Get("To"); got != "alice@example.org" {
+		t.Errorf("got To %q; want %q", got, "alice@example.org")
+	}
+
+	if got := parsed.Header.Get("From"); got != "GoTodo <no-reply@gotodo.local>" {
+		t.Errorf("got From %q; want the sender", got)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Confirm your new GoTodo email address" {
+		t.Errorf("got subject %q (error %v); want the template's subject", subject, err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got Content-Type %q; want multipart/alternative", parsed.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+
+	for _, want := range []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("reading the %s part: %v", want, err)
+		}
+
+		if got := part.Header.Get("Content-Type"); got != want {
+			t.Errorf("got part %q; want %q", got, want)
+		}
+
+		// The multipart reader undoes the quoted-printable encoding.
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range []string{"Hi Alice", "ABCDEFGHIJKLMNOPQRSTUVWXYZ"} {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("%s part doesn't contain %q:\n%s", want, s, body)
+			}
+		}
+	}
+}
+
+func TestMessageUnknownTemplate(t *testing.T) {
+	m := New("smtp.example.com", 587, "", "", "GoTodo <no-reply@gotodo.local>")
+
+	_, err := m.message("alice@example.org", "missing.tmpl", nil)
+	if err == nil {
+		t.Error("got nil error; want an error")
+	}
+}
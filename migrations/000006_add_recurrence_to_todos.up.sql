@@ -0,0 +1,2 @@
+ALTER TABLE todos
+ADD COLUMN recurrence text NOT NULL DEFAULT 'none';
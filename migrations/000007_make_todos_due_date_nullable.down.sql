@@ -0,0 +1,6 @@
+UPDATE todos
+SET due_date = created_at
+WHERE due_date IS NULL;
+
+ALTER TABLE todos
+ALTER COLUMN due_date SET NOT NULL;
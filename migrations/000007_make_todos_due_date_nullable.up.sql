@@ -0,0 +1,2 @@
+ALTER TABLE todos
+ALTER COLUMN due_date DROP NOT NULL;
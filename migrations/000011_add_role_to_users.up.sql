@@ -0,0 +1,5 @@
+ALTER TABLE users
+ADD COLUMN role text NOT NULL DEFAULT 'user';
+
+ALTER TABLE users
+ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
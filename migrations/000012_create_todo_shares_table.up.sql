@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS todo_shares (
+    todo_id bigint NOT NULL REFERENCES todos ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, user_id)
+);
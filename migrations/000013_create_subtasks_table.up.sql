@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS subtasks (
+    id bigserial PRIMARY KEY,
+    todo_id bigint NOT NULL REFERENCES todos ON DELETE CASCADE,
+    title text NOT NULL,
+    is_completed boolean NOT NULL DEFAULT false,
+    position integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS subtasks_todo_id_idx ON subtasks (todo_id);
@@ -0,0 +1,4 @@
+ALTER TABLE todos
+DROP COLUMN IF EXISTS project_id;
+
+DROP TABLE IF EXISTS projects;
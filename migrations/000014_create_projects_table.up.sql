@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS projects (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (user_id, name)
+);
+
+ALTER TABLE todos
+ADD COLUMN project_id bigint REFERENCES projects ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS todos_project_id_idx ON todos (project_id);
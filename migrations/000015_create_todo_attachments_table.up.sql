@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS todo_attachments (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    todo_id bigint NOT NULL REFERENCES todos ON DELETE CASCADE,
+    url text NOT NULL,
+    filename text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS todo_attachments_todo_id_idx ON todo_attachments (todo_id);
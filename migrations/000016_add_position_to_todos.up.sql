@@ -0,0 +1,10 @@
+ALTER TABLE todos
+ADD COLUMN position integer NOT NULL DEFAULT 0;
+
+UPDATE todos
+SET position = ordered.position
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY user_id ORDER BY created_at, id) - 1 AS position
+    FROM todos
+) AS ordered
+WHERE todos.id = ordered.id;
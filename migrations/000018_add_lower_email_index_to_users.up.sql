@@ -0,0 +1,5 @@
+UPDATE users
+SET email = lower(email)
+WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (lower(email));
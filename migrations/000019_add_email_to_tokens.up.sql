@@ -0,0 +1,2 @@
+ALTER TABLE tokens
+ADD COLUMN email text NOT NULL DEFAULT '';
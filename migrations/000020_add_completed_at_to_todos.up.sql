@@ -0,0 +1,6 @@
+ALTER TABLE todos
+ADD COLUMN completed_at timestamp(0) with time zone;
+
+UPDATE todos
+SET completed_at = created_at
+WHERE is_completed;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS todos_tsv_idx;
+
+ALTER TABLE todos
+DROP COLUMN IF EXISTS tsv;
@@ -0,0 +1,7 @@
+ALTER TABLE todos
+ADD COLUMN tsv tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') ||
+    setweight(to_tsvector('simple', description), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS todos_tsv_idx ON todos USING GIN (tsv);
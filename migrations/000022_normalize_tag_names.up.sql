@@ -0,0 +1,23 @@
+INSERT INTO todo_tags (todo_id, tag_id)
+SELECT todo_tags.todo_id, canonical.id
+FROM todo_tags
+INNER JOIN tags ON tags.id = todo_tags.tag_id
+INNER JOIN (
+    SELECT DISTINCT ON (user_id, lower(trim(name))) id, user_id, lower(trim(name)) AS name
+    FROM tags
+    ORDER BY user_id, lower(trim(name)), id
+) AS canonical ON canonical.user_id = tags.user_id AND canonical.name = lower(trim(tags.name))
+WHERE canonical.id <> tags.id
+ON CONFLICT DO NOTHING;
+
+DELETE FROM tags
+USING tags AS canonical
+WHERE canonical.user_id = tags.user_id
+AND lower(trim(canonical.name)) = lower(trim(tags.name))
+AND canonical.id < tags.id;
+
+UPDATE tags
+SET name = lower(trim(name))
+WHERE name <> lower(trim(name));
+
+CREATE UNIQUE INDEX IF NOT EXISTS tags_user_id_lower_name_idx ON tags (user_id, lower(name));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS tokens_user_id_session_id_idx;
+
+ALTER TABLE tokens
+DROP COLUMN IF EXISTS session_id;
@@ -0,0 +1,11 @@
+ALTER TABLE tokens
+ADD COLUMN session_id text NOT NULL DEFAULT '';
+
+-- Tokens issued before sessions were tracked keep the id clients already know
+-- them by, the start of their hex encoded hash. Their refresh tokens can't be
+-- matched to an authentication token, so each one becomes its own session.
+UPDATE tokens
+SET session_id = left(encode(hash, 'hex'), 16)
+WHERE scope IN ('Authentication', 'Refresh');
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_session_id_idx ON tokens (user_id, session_id);